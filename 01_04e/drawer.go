@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Drawer is a cash drawer holding a finite number of each coin.
+// It is safe for concurrent use by multiple registers.
+type Drawer struct {
+	mu     sync.Mutex
+	denoms []coin
+	counts map[coin]int
+}
+
+// NewDrawer returns an empty drawer for the given coin system.
+func NewDrawer(denoms []coin) *Drawer {
+	d := &Drawer{
+		denoms: append([]coin(nil), denoms...),
+		counts: make(map[coin]int),
+	}
+	sortCoins(d.denoms)
+
+	return d
+}
+
+// InsufficientCoinsError is returned when the drawer does not
+// hold the coins required to make change.
+type InsufficientCoinsError struct {
+	Amount float64
+	// Missing is the fewest extra coins that would make the change.
+	Missing map[coin]int
+}
+
+// Error says how many more coins the drawer needs to make the change,
+// and gives the fewest extra coins that would do. Other coins may do
+// as well, so they are only an example.
+func (e *InsufficientCoinsError) Error() string {
+	var missing []string
+	total := 0
+	for _, c := range orderedCoins(e.Missing) {
+		missing = append(missing, fmt.Sprintf("%d x %s", e.Missing[c], c.name))
+		total += e.Missing[c]
+	}
+	if len(missing) == 0 {
+		return fmt.Sprintf("cannot make change for %.2f with these coins", e.Amount)
+	}
+
+	noun := "coins"
+	if total == 1 {
+		noun = "coin"
+	}
+	return fmt.Sprintf("cannot make change for %.2f: needs %d more %s, e.g. %s",
+		e.Amount, total, noun, strings.Join(missing, ", "))
+}
+
+// Add puts count coins of the given type into the drawer.
+func (d *Drawer) Add(c coin, count int) error {
+	if count < 0 {
+		return fmt.Errorf("cannot add %d x %s", count, c.name)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.accepts(c) {
+		return fmt.Errorf("drawer does not accept %s", c.name)
+	}
+	d.counts[c] += count
+
+	return nil
+}
+
+// TopUp adds the given amount of money to the drawer, using
+// the fewest coins possible.
+func (d *Drawer) TopUp(amount float64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	change, ok := optimalChange(toUnits(amount), d.denoms)
+	if !ok {
+		return fmt.Errorf("cannot top up %.2f with these coins", amount)
+	}
+	for c, count := range change {
+		d.counts[c] += count
+	}
+
+	return nil
+}
+
+// Count returns how many coins of the given type are in the drawer.
+func (d *Drawer) Count(c coin) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.counts[c]
+}
+
+// Inventory returns a copy of the coins in the drawer.
+func (d *Drawer) Inventory() map[coin]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	inv := make(map[coin]int, len(d.counts))
+	for c, count := range d.counts {
+		if count > 0 {
+			inv[c] = count
+		}
+	}
+
+	return inv
+}
+
+// MakeChange removes the fewest coins that add up to the given
+// amount from the drawer. The drawer is left untouched if the
+// change cannot be paid, and an *InsufficientCoinsError is returned.
+func (d *Drawer) MakeChange(amount float64) (map[coin]int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	units := toUnits(amount)
+	if units < 0 {
+		return nil, fmt.Errorf("cannot make change for negative amount %.2f", amount)
+	}
+	change, ok := boundedChange(units, d.denoms, d.counts)
+	if !ok {
+		return nil, &InsufficientCoinsError{
+			Amount:  amount,
+			Missing: d.missing(units),
+		}
+	}
+	for c, count := range change {
+		d.counts[c] -= count
+	}
+
+	return change, nil
+}
+
+// accepts returns whether the coin belongs to the drawer's coin system.
+func (d *Drawer) accepts(c coin) bool {
+	for _, dc := range d.denoms {
+		if dc == c {
+			return true
+		}
+	}
+	return false
+}
+
+// missing returns the fewest extra coins that would let the drawer
+// pay the given amount. Of the ways to pay it with that few extra
+// coins, the one using the fewest coins in all is picked.
+func (d *Drawer) missing(amount int) map[coin]int {
+	// best[a] is the fewest extra coins, then the fewest coins,
+	// making a using the coins seen so far, and used[i][a] is how
+	// many of coin i that solution takes. Extra is -1 when a cannot
+	// be made at all.
+	type cost struct{ extra, coins int }
+	better := func(x, y cost) bool {
+		if y.extra < 0 {
+			return x.extra >= 0
+		}
+		return x.extra >= 0 && (x.extra < y.extra || (x.extra == y.extra && x.coins < y.coins))
+	}
+	best := make([]cost, amount+1)
+	for a := 1; a <= amount; a++ {
+		best[a] = cost{-1, 0}
+	}
+	used := make([][]int, len(d.denoms))
+	for i, c := range d.denoms {
+		v := toUnits(c.value)
+		used[i] = make([]int, amount+1)
+		next := make([]cost, amount+1)
+		for a := 0; a <= amount; a++ {
+			next[a] = best[a]
+			for k := 1; v > 0 && k*v <= a; k++ {
+				prev := best[a-k*v]
+				if prev.extra < 0 {
+					continue
+				}
+				cand := cost{prev.extra, prev.coins + k}
+				if k > d.counts[c] {
+					cand.extra += k - d.counts[c]
+				}
+				if better(cand, next[a]) {
+					next[a] = cand
+					used[i][a] = k
+				}
+			}
+		}
+		best = next
+	}
+
+	missing := make(map[coin]int)
+	if best[amount].extra < 0 {
+		return missing
+	}
+	for i := len(d.denoms) - 1; i >= 0; i-- {
+		c := d.denoms[i]
+		if k := used[i][amount]; k > 0 {
+			if short := k - d.counts[c]; short > 0 {
+				missing[c] = short
+			}
+			amount -= k * toUnits(c.value)
+		}
+	}
+
+	return missing
+}
+
+// boundedChange makes change using the fewest coins while using
+// no more of each coin than is available. It returns false if
+// the amount cannot be paid from the available coins.
+func boundedChange(amount int, denoms []coin, available map[coin]int) (map[coin]int, bool) {
+	// best[a] is the fewest coins making a using the coins seen so far,
+	// and used[i][a] is how many of coin i that solution takes.
+	best := make([]int, amount+1)
+	for a := 1; a <= amount; a++ {
+		best[a] = -1
+	}
+	used := make([][]int, len(denoms))
+	for i, c := range denoms {
+		v := toUnits(c.value)
+		used[i] = make([]int, amount+1)
+		next := make([]int, amount+1)
+		for a := 0; a <= amount; a++ {
+			next[a] = best[a]
+			for k := 1; v > 0 && k <= available[c] && k*v <= a; k++ {
+				prev := best[a-k*v]
+				if prev < 0 {
+					continue
+				}
+				if next[a] < 0 || prev+k < next[a] {
+					next[a] = prev + k
+					used[i][a] = k
+				}
+			}
+		}
+		best = next
+	}
+	if best[amount] < 0 {
+		return nil, false
+	}
+	change := make(map[coin]int)
+	for i := len(denoms) - 1; i >= 0; i-- {
+		if k := used[i][amount]; k > 0 {
+			change[denoms[i]] = k
+			amount -= k * toUnits(denoms[i].value)
+		}
+	}
+
+	return change, true
+}
+
+// orderedCoins returns the coins in the map from highest to lowest value.
+func orderedCoins(change map[coin]int) []coin {
+	ordered := make([]coin, 0, len(change))
+	for c := range change {
+		ordered = append(ordered, c)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].value != ordered[j].value {
+			return ordered[i].value > ordered[j].value
+		}
+		return ordered[i].name < ordered[j].name
+	})
+
+	return ordered
+}
+
+// parseDrawer creates a drawer from a comma separated list of
+// coin values and counts such as "1=5,0.5=2,0.01=100".
+func parseDrawer(s string, denoms []coin) (*Drawer, error) {
+	counts, err := parseCounts(s, denoms)
+	if err != nil {
+		return nil, err
+	}
+	d := NewDrawer(denoms)
+	for c, count := range counts {
+		if err := d.Add(c, count); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// parseCounts parses a comma separated list of coin values and
+// counts such as "1=5,0.5=2" into a count per coin.
+func parseCounts(s string, denoms []coin) (map[coin]int, error) {
+	counts := make(map[coin]int)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid coin count %q: want value=count", field)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coin count %q: %v", field, err)
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid coin count %q: %v", field, err)
+		}
+		if count < 0 {
+			return nil, fmt.Errorf("invalid coin count %q: count cannot be negative", field)
+		}
+		c, ok := findCoin(denoms, value)
+		if !ok {
+			return nil, fmt.Errorf("invalid coin count %q: no coin worth %.2f", field, value)
+		}
+		counts[c] += count
+	}
+
+	return counts, nil
+}
+
+// findCoin returns the coin with the given value.
+func findCoin(denoms []coin, value float64) (coin, bool) {
+	for _, c := range denoms {
+		if toUnits(c.value) == toUnits(value) {
+			return c, true
+		}
+	}
+	return coin{}, false
+}
@@ -2,8 +2,9 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
-	"math"
+	"strings"
 )
 
 // coin contains the name and value of a coin
@@ -23,15 +24,19 @@ var coins = []coin{
 }
 
 // calculateChange returns the coins required to calculate the
+// given amount. Canonical coin systems use the greedy algorithm,
+// while other coin systems, or amounts greedy cannot make, are
+// solved optimally.
 func calculateChange(amount float64) map[coin]int {
-	change := make(map[coin]int)
-	for _, coin := range coins {
-		if amount >= coin.value {
-			count := math.Floor(amount/coin.value)
-			amount = amount - count*coin.value
-			change[coin] = int(count)
+	if isCanonical(coins) {
+		if change, ok := greedyChange(toUnits(amount), coins); ok {
+			return change
 		}
 	}
+	change, ok := optimalChange(toUnits(amount), coins)
+	if !ok {
+		return map[coin]int{}
+	}
 
 	return change
 }
@@ -43,14 +48,117 @@ func printCoins(change map[coin]int) {
 		return
 	}
 	log.Println("Change has been calculated.")
-	for coin, count := range change {
-		log.Printf("%d x %s \n", count, coin.name)
+	for _, coin := range orderedCoins(change) {
+		log.Printf("%d x %s \n", change[coin], coin.name)
+	}
+}
+
+// printWays prints the number of ways to make the amount and
+// lists up to n of them to the terminal.
+func printWays(amount float64, limits map[coin]int, n int) {
+	total := countWays(toUnits(amount), coins, limits)
+	log.Printf("There are %s ways to make %.2f.\n", total.String(), amount)
+	if n == 0 {
+		return
+	}
+	done := make(chan struct{})
+	defer close(done)
+	i := 0
+	for way := range streamWays(done, toUnits(amount), coins, limits) {
+		if n > 0 && i == n {
+			break
+		}
+		var parts []string
+		for _, c := range orderedCoins(way) {
+			parts = append(parts, fmt.Sprintf("%d x %s", way[c], c.name))
+		}
+		log.Printf("[%d]: %s\n", i, strings.Join(parts, ", "))
+		i++
+	}
+}
+
+// printDrawer prints the coins left in the drawer to the terminal.
+func printDrawer(d *Drawer) {
+	inv := d.Inventory()
+	if len(inv) == 0 {
+		log.Println("The drawer is empty.")
+		return
+	}
+	log.Println("Coins left in the drawer:")
+	for _, c := range orderedCoins(inv) {
+		log.Printf("%d x %s \n", inv[c], c.name)
 	}
 }
 
 func main() {
 	amount := flag.Float64("amount", 0.0, "The amount you want to make change for")
+	price := flag.Float64("price", 0.0, "The price of the item being paid for")
+	tendered := flag.Float64("tendered", 0.0, "The cash handed over for the item")
+	step := flag.Float64("round", 0.0,
+		"The cash rounding step applied to the price, e.g. 0.05 for Swedish rounding")
+	denoms := flag.String("coins", "",
+		"Comma separated coins to use instead of pounds and pence, e.g. 4p=0.04,3p=0.03,1p=0.01")
+	inventory := flag.String("drawer", "",
+		"Comma separated coin values and counts in the cash drawer, e.g. 1=5,0.5=2,0.01=100")
+	ways := flag.Bool("ways", false, "Count every distinct way to make the amount")
+	list := flag.Int("list", 0, "The number of ways to list when counting ways, -1 for all")
+	limit := flag.String("limits", "",
+		"Comma separated coin values and the most of each coin to use when counting ways, e.g. 1=2,0.5=1")
 	flag.Parse()
-	change := calculateChange(*amount)
-	printCoins(change)
+	if *denoms != "" {
+		c, err := parseCoins(*denoms)
+		if err != nil {
+			log.Fatal(err)
+		}
+		coins = c
+	}
+	if !isCanonical(coins) {
+		log.Println("The coin system is not canonical, solving for the fewest coins.")
+	}
+	if *ways {
+		limits, err := parseCounts(*limit, coins)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printWays(*amount, limits, *list)
+		return
+	}
+	var d *Drawer
+	if *inventory != "" {
+		var err error
+		d, err = parseDrawer(*inventory, coins)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *price == 0 && *tendered == 0 {
+		change, err := makeChange(*amount, d)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printCoins(change)
+	} else {
+		t, err := newTender(*price, *tendered, *step)
+		if err != nil {
+			log.Fatal(err)
+		}
+		change, err := makeChange(t.change, d)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printReceipt(t, change)
+	}
+	if d != nil {
+		printDrawer(d)
+	}
+}
+
+// makeChange returns the change for the amount, taken from
+// the drawer if there is one.
+func makeChange(amount float64, d *Drawer) (map[coin]int, error) {
+	if d == nil {
+		return calculateChange(amount), nil
+	}
+	return d.MakeChange(amount)
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// unit is the smallest amount of money change is made in.
+// All amounts are converted to a whole number of units before
+// solving, which avoids floating point rounding errors.
+const unit = 0.01
+
+// toUnits converts the given amount of money to a whole number of units.
+func toUnits(amount float64) int {
+	return int(math.Round(amount / unit))
+}
+
+// greedyChange makes change by always taking as many of the
+// highest value coin as possible. It is only guaranteed to use
+// the fewest coins for canonical coin systems, and returns false
+// if it could not make the whole amount.
+func greedyChange(amount int, denoms []coin) (map[coin]int, bool) {
+	change := make(map[coin]int)
+	for _, c := range denoms {
+		v := toUnits(c.value)
+		if v <= 0 || amount < v {
+			continue
+		}
+		change[c] = amount / v
+		amount = amount % v
+	}
+
+	return change, amount == 0
+}
+
+// optimalChange makes change using the fewest coins possible for
+// any coin system. It returns false if the amount cannot be made
+// from the given coins.
+func optimalChange(amount int, denoms []coin) (map[coin]int, bool) {
+	best, last := minCoinsTable(amount, denoms)
+	if amount < 0 || best[amount] < 0 {
+		return nil, false
+	}
+	change := make(map[coin]int)
+	for amount > 0 {
+		c := denoms[last[amount]]
+		change[c]++
+		amount -= toUnits(c.value)
+	}
+
+	return change, true
+}
+
+// minCoinsTable returns the fewest coins needed to make every amount
+// from 0 to max, and the index of the coin used last for each amount.
+// Amounts that cannot be made have a count of -1.
+func minCoinsTable(max int, denoms []coin) ([]int, []int) {
+	if max < 0 {
+		return nil, nil
+	}
+	best := make([]int, max+1)
+	last := make([]int, max+1)
+	for a := 1; a <= max; a++ {
+		best[a] = -1
+		for i, c := range denoms {
+			v := toUnits(c.value)
+			if v <= 0 || v > a || best[a-v] < 0 {
+				continue
+			}
+			if best[a] < 0 || best[a-v]+1 < best[a] {
+				best[a] = best[a-v] + 1
+				last[a] = i
+			}
+		}
+	}
+
+	return best, last
+}
+
+// isCanonical returns whether the greedy algorithm makes optimal
+// change for every amount in the given coin system.
+// If a counterexample exists, the smallest one is less than the
+// sum of the two highest value coins, so only those amounts are checked.
+// That bound needs a 1 unit coin, so systems without one are never
+// treated as canonical.
+func isCanonical(denoms []coin) bool {
+	values := make([]int, 0, len(denoms))
+	hasUnit := false
+	for _, c := range denoms {
+		v := toUnits(c.value)
+		values = append(values, v)
+		if v == 1 {
+			hasUnit = true
+		}
+	}
+	if !hasUnit {
+		return false
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(values)))
+	if len(values) < 2 {
+		return true
+	}
+	max := values[0] + values[1]
+	best, _ := minCoinsTable(max, denoms)
+	for a := 1; a < max; a++ {
+		if best[a] < 0 {
+			continue
+		}
+		greedy := 0
+		rest := a
+		for _, v := range values {
+			if v <= 0 {
+				continue
+			}
+			greedy += rest / v
+			rest = rest % v
+		}
+		if rest != 0 || greedy > best[a] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortCoins orders the coins from highest to lowest value,
+// which is the order the greedy algorithm expects.
+func sortCoins(denoms []coin) {
+	sort.SliceStable(denoms, func(i, j int) bool {
+		return denoms[i].value > denoms[j].value
+	})
+}
+
+// parseCoins parses a comma separated list of coins such as
+// "4p=0.04,3p=0.03,1p=0.01". The name is optional and defaults to the value.
+func parseCoins(s string) ([]coin, error) {
+	var denoms []coin
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, value := field, field
+		if i := strings.LastIndex(field, "="); i >= 0 {
+			name, value = strings.TrimSpace(field[:i]), strings.TrimSpace(field[i+1:])
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coin %q: %v", field, err)
+		}
+		if toUnits(v) <= 0 {
+			return nil, fmt.Errorf("invalid coin %q: value must be at least %.2f", field, unit)
+		}
+		denoms = append(denoms, coin{name: name, value: v})
+	}
+	if len(denoms) == 0 {
+		return nil, fmt.Errorf("no coins given")
+	}
+	sortCoins(denoms)
+
+	return denoms, nil
+}
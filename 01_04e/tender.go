@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// tender is a cash payment for an item at the till.
+type tender struct {
+	price    float64
+	rounded  float64
+	tendered float64
+	change   float64
+}
+
+// roundCash rounds the amount to the nearest multiple of step,
+// rounding halves up. Swedish rounding uses a step of 0.05.
+// A step of zero or less leaves the amount unchanged.
+func roundCash(amount, step float64) float64 {
+	s := toUnits(step)
+	if s <= 0 {
+		return amount
+	}
+	units := toUnits(amount)
+	rounded := int(math.Floor(float64(units)/float64(s)+0.5)) * s
+
+	return float64(rounded) * unit
+}
+
+// newTender returns the tender for paying the price in cash.
+// The price is rounded with the given cash rounding step first.
+func newTender(price, tendered, step float64) (tender, error) {
+	if price < 0 {
+		return tender{}, fmt.Errorf("price %.2f cannot be negative", price)
+	}
+	rounded := roundCash(price, step)
+	if toUnits(tendered) < toUnits(rounded) {
+		return tender{}, fmt.Errorf("tendered %.2f does not cover the price of %.2f",
+			tendered, rounded)
+	}
+
+	return tender{
+		price:    price,
+		rounded:  rounded,
+		tendered: tendered,
+		change:   float64(toUnits(tendered)-toUnits(rounded)) * unit,
+	}, nil
+}
+
+// printReceipt prints the receipt for the tender and the
+// coins given as change to the terminal.
+func printReceipt(t tender, change map[coin]int) {
+	log.Println("---------- RECEIPT ----------")
+	log.Printf("Price:     %8.2f\n", t.price)
+	if toUnits(t.rounded) != toUnits(t.price) {
+		log.Printf("Rounding:  %+8.2f\n", t.rounded-t.price)
+		log.Printf("To pay:    %8.2f\n", t.rounded)
+	}
+	log.Printf("Tendered:  %8.2f\n", t.tendered)
+	log.Printf("Change:    %8.2f\n", t.change)
+	for _, c := range orderedCoins(change) {
+		log.Printf("  %3d x %-10s %8.2f\n", change[c], c.name, float64(change[c])*c.value)
+	}
+	log.Println("-----------------------------")
+}
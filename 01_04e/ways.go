@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math/big"
+)
+
+// countWays returns the number of distinct ways to make the amount
+// from the given coins, regardless of the order of the coins.
+// Coins in limits may be used at most that many times, while
+// all other coins may be used any number of times.
+func countWays(amount int, denoms []coin, limits map[coin]int) *big.Int {
+	if amount < 0 {
+		return big.NewInt(0)
+	}
+	ways := make([]*big.Int, amount+1)
+	for a := range ways {
+		ways[a] = big.NewInt(0)
+	}
+	ways[0].SetInt64(1)
+	for _, c := range denoms {
+		v := toUnits(c.value)
+		if v <= 0 {
+			continue
+		}
+		limit, limited := limits[c]
+		if !limited {
+			for a := v; a <= amount; a++ {
+				ways[a].Add(ways[a], ways[a-v])
+			}
+			continue
+		}
+		// With at most limit coins, next[a] is the sum of
+		// ways[a-k*v] for k from 0 to limit, kept as a sliding window.
+		next := make([]*big.Int, amount+1)
+		for a := 0; a <= amount; a++ {
+			next[a] = new(big.Int).Set(ways[a])
+			if a >= v {
+				next[a].Add(next[a], next[a-v])
+			}
+			if drop := a - (limit+1)*v; drop >= 0 {
+				next[a].Sub(next[a], ways[drop])
+			}
+		}
+		ways = next
+	}
+
+	return ways[amount]
+}
+
+// streamWays lazily sends every distinct way to make the amount
+// from the given coins on the returned channel, using the same
+// limits as countWays. The channel is closed once all ways have
+// been sent or the done channel is closed.
+func streamWays(done <-chan struct{}, amount int, denoms []coin,
+	limits map[coin]int) <-chan map[coin]int {
+	out := make(chan map[coin]int)
+	sorted := append([]coin(nil), denoms...)
+	sortCoins(sorted)
+	go func() {
+		defer close(out)
+		counts := make([]int, len(sorted))
+		walkWays(done, out, amount, sorted, limits, counts, 0)
+	}()
+
+	return out
+}
+
+// walkWays picks how many of the i-th coin to use and recurses
+// into the remaining coins. It returns false once done is closed.
+func walkWays(done <-chan struct{}, out chan<- map[coin]int, amount int,
+	denoms []coin, limits map[coin]int, counts []int, i int) bool {
+	if amount == 0 {
+		way := make(map[coin]int)
+		for j, count := range counts {
+			if count > 0 {
+				way[denoms[j]] = count
+			}
+		}
+		select {
+		case out <- way:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	if i == len(denoms) {
+		return true
+	}
+	v := toUnits(denoms[i].value)
+	if v <= 0 {
+		return walkWays(done, out, amount, denoms, limits, counts, i+1)
+	}
+	most := amount / v
+	if limit, ok := limits[denoms[i]]; ok && limit < most {
+		most = limit
+	}
+	for k := most; k >= 0; k-- {
+		counts[i] = k
+		if !walkWays(done, out, amount-k*v, denoms, limits, counts, i+1) {
+			counts[i] = 0
+			return false
+		}
+	}
+	counts[i] = 0
+
+	return true
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+)
+
+// exactBasketLimit is the largest table, in items times budget
+// cents, that the exact basket optimizer is allowed to fill.
+// Larger catalogs fall back to the greedy heuristic.
+const exactBasketLimit = 10_000_000
+
+// objective is what the basket optimizer maximizes.
+type objective int
+
+const (
+	maxSavings objective = iota
+	maxCount
+)
+
+// parseObjective returns the objective with the given name.
+func parseObjective(name string) (objective, error) {
+	switch name {
+	case "savings":
+		return maxSavings, nil
+	case "count":
+		return maxCount, nil
+	}
+	return 0, fmt.Errorf("unknown basket objective %q: want savings or count", name)
+}
+
+// value returns how much the item is worth to the objective.
+func (o objective) value(si SaleItem) int {
+	if o == maxCount {
+		return 1
+	}
+	if saved := toCents(si.OriginalPrice) - toCents(si.ReducedPrice); saved > 0 {
+		return saved
+	}
+	return 0
+}
+
+// basket is a set of sale items bought together.
+type basket struct {
+	Items []SaleItem
+	Total float64
+	Saved float64
+	Exact bool
+}
+
+// toCents converts the price to a whole number of cents.
+func toCents(price float64) int {
+	return int(math.Round(price * 100))
+}
+
+// buildBasket picks the items that maximize the objective without
+// the total reduced price going over the budget. Small catalogs are
+// solved exactly, while large ones use a greedy heuristic.
+func buildBasket(budget float64, items []SaleItem, obj objective) basket {
+	capacity := toCents(budget)
+	if capacity < 0 {
+		return basket{Exact: true}
+	}
+	var picked []int
+	exact := len(items)*(capacity+1) <= exactBasketLimit
+	if exact {
+		picked = exactBasket(capacity, items, obj)
+	} else {
+		picked = greedyBasket(capacity, items, obj)
+	}
+
+	b := basket{Exact: exact}
+	for _, i := range picked {
+		si := items[i]
+		b.Items = append(b.Items, si)
+		b.Total += si.ReducedPrice
+		b.Saved += si.OriginalPrice - si.ReducedPrice
+	}
+	sort.Slice(b.Items, func(i, j int) bool {
+		return b.Items[i].Name < b.Items[j].Name
+	})
+
+	return b
+}
+
+// exactBasket solves the 0/1 knapsack over the budget in cents and
+// returns the indices of the chosen items.
+func exactBasket(capacity int, items []SaleItem, obj objective) []int {
+	best := make([]int, capacity+1)
+	keep := make([][]bool, len(items))
+	for i, si := range items {
+		keep[i] = make([]bool, capacity+1)
+		w, v := toCents(si.ReducedPrice), obj.value(si)
+		if w < 0 || v <= 0 {
+			continue
+		}
+		for a := capacity; a >= w; a-- {
+			if best[a-w]+v > best[a] {
+				best[a] = best[a-w] + v
+				keep[i][a] = true
+			}
+		}
+	}
+
+	var picked []int
+	a := capacity
+	for i := len(items) - 1; i >= 0; i-- {
+		if keep[i][a] {
+			picked = append(picked, i)
+			a -= toCents(items[i].ReducedPrice)
+		}
+	}
+
+	return picked
+}
+
+// greedyBasket adds items in order of value per cent spent while
+// they fit in the budget. The result is compared with the single
+// most valuable item, which bounds how far it can be from optimal.
+func greedyBasket(capacity int, items []SaleItem, obj objective) []int {
+	order := make([]int, 0, len(items))
+	for i, si := range items {
+		if obj.value(si) > 0 && toCents(si.ReducedPrice) >= 0 {
+			order = append(order, i)
+		}
+	}
+	density := func(i int) float64 {
+		w := toCents(items[i].ReducedPrice)
+		if w == 0 {
+			return math.Inf(1)
+		}
+		return float64(obj.value(items[i])) / float64(w)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return density(order[i]) > density(order[j])
+	})
+
+	var picked []int
+	spent, total := 0, 0
+	bestSingle, bestValue := -1, 0
+	for _, i := range order {
+		w, v := toCents(items[i].ReducedPrice), obj.value(items[i])
+		if w > capacity {
+			continue
+		}
+		if v > bestValue {
+			bestSingle, bestValue = i, v
+		}
+		if spent+w <= capacity {
+			picked = append(picked, i)
+			spent += w
+			total += v
+		}
+	}
+	if bestValue > total {
+		return []int{bestSingle}
+	}
+
+	return picked
+}
+
+// printBasket prints the chosen basket and how much it saves.
+func printBasket(b basket) {
+	log.Println("The BIG sale has started with our best basket for you!")
+	if len(b.Items) == 0 {
+		log.Println("No items found.:( Try increasing your budget.")
+		return
+	}
+	if !b.Exact {
+		log.Println("The catalog is large, so this basket is a close estimate.")
+	}
+	for i, r := range b.Items {
+		log.Printf("[%d]:%s for JUST %.2f, saving %.2f!\n",
+			i, r.Name, r.ReducedPrice, r.OriginalPrice-r.ReducedPrice)
+	}
+	log.Printf("Basket total is %.2f and you save %.2f!\n", b.Total, b.Saved)
+}
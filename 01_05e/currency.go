@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// currencyDecimals are the minor unit digits of the currencies that
+// do not use two decimal places. All other currencies use two.
+var currencyDecimals = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+	"TND": 3,
+	"VND": 0,
+}
+
+// rateTable is the exchange rate table read from file. Rates are
+// the units of each currency that one unit of the base buys.
+type rateTable struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// loadRates reads and validates the exchange rate table.
+func loadRates(p string) (*rateTable, error) {
+	file, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var t rateTable
+	dec := json.NewDecoder(bytes.NewReader(file))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	t.Base = strings.ToUpper(t.Base)
+	if t.Base == "" {
+		return nil, fmt.Errorf("%s: base currency is missing", p)
+	}
+	rates := make(map[string]float64, len(t.Rates)+1)
+	for code, r := range t.Rates {
+		if r <= 0 || math.IsInf(r, 0) {
+			return nil, fmt.Errorf("%s: rate %v for %s must be above zero", p, r, code)
+		}
+		rates[strings.ToUpper(code)] = r
+	}
+	rates[t.Base] = 1
+	t.Rates = rates
+
+	return &t, nil
+}
+
+// decimals returns the number of decimal places prices in the currency have.
+func decimals(code string) int {
+	if d, ok := currencyDecimals[strings.ToUpper(code)]; ok {
+		return d
+	}
+	return 2
+}
+
+// formatPrice formats the amount with the decimal places and code of the currency.
+func formatPrice(amount float64, code string) string {
+	return fmt.Sprintf("%.*f %s", decimals(code), amount, strings.ToUpper(code))
+}
+
+// convert converts the amount between currencies, rounded to the
+// minor unit of the target currency. An empty from is the base.
+func (t *rateTable) convert(amount float64, from, to string) (float64, error) {
+	if from == "" {
+		from = t.Base
+	}
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	fr, ok := t.Rates[from]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", from)
+	}
+	tr, ok := t.Rates[to]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", to)
+	}
+	scale := math.Pow(10, float64(decimals(to)))
+
+	return math.Round(amount/fr*tr*scale) / scale, nil
+}
+
+// convertItems returns copies of the items with their prices in
+// the given currency. Each copy keeps the item it was converted from.
+func convertItems(items []SaleItem, t *rateTable, to string) ([]SaleItem, error) {
+	converted := make([]SaleItem, 0, len(items))
+	for _, si := range items {
+		source := si
+		source.Currency = currencyOf(si, t.Base)
+		var err error
+		if si.OriginalPrice, err = t.convert(si.OriginalPrice, si.Currency, to); err != nil {
+			return nil, fmt.Errorf("%s: %v", si.Name, err)
+		}
+		if si.ReducedPrice, err = t.convert(si.ReducedPrice, si.Currency, to); err != nil {
+			return nil, fmt.Errorf("%s: %v", si.Name, err)
+		}
+		si.Currency = strings.ToUpper(to)
+		si.Source = &source
+		converted = append(converted, si)
+	}
+
+	return converted, nil
+}
+
+// currencyOf returns the currency code of the item, which is the
+// base currency when the item does not set one.
+func currencyOf(si SaleItem, base string) string {
+	if si.Currency == "" {
+		return base
+	}
+	return strings.ToUpper(si.Currency)
+}
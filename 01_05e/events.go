@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// activeAt returns whether the item's sale is running at the given
+// time. Items without a start or end time are on sale indefinitely.
+func (si SaleItem) activeAt(t time.Time) bool {
+	if si.StartsAt != nil && t.Before(*si.StartsAt) {
+		return false
+	}
+	if si.EndsAt != nil && !t.Before(*si.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// activeItems returns the items whose sale is running at the given time.
+func activeItems(items []SaleItem, at time.Time) []SaleItem {
+	var ai []SaleItem
+	for _, si := range items {
+		if si.activeAt(at) {
+			ai = append(ai, si)
+		}
+	}
+	return ai
+}
+
+// parseAt parses the time to check the sale at, which
+// defaults to now when empty.
+func parseAt(s string) (time.Time, error) {
+	if s == "" {
+		return time.Now(), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// upcomingSales returns the items within budget whose sale starts
+// after at but within the given window, ordered by start time.
+func upcomingSales(budget float64, items []SaleItem, at time.Time,
+	within time.Duration) []SaleItem {
+	var ui []SaleItem
+	for _, si := range items {
+		if si.StartsAt == nil || si.ReducedPrice > budget {
+			continue
+		}
+		if !si.StartsAt.After(at) || si.StartsAt.After(at.Add(within)) {
+			continue
+		}
+		si.SalePercentage = -(si.ReducedPrice - si.OriginalPrice) /
+			si.OriginalPrice * 100
+		ui = append(ui, si)
+	}
+	sort.SliceStable(ui, func(i, j int) bool {
+		return ui[i].StartsAt.Before(*ui[j].StartsAt)
+	})
+
+	return ui
+}
+
+// printUpcoming prints the items whose sale is about to start.
+func printUpcoming(items []SaleItem, at time.Time) {
+	log.Println("Coming soon to the BIG sale!")
+	if len(items) == 0 {
+		log.Println("No upcoming deals found.:( Try again later.")
+	}
+	for i, r := range items {
+		line := "[%d]:%s will be %.2f OFF in %s! Get it for JUST %.2f"
+		args := []interface{}{i, r.Name, r.SalePercentage,
+			r.StartsAt.Sub(at).Round(time.Minute), r.ReducedPrice}
+		if r.EndsAt != nil {
+			line += " until %s"
+			args = append(args, r.EndsAt.Format(time.RFC1123))
+		}
+		log.Printf(line+"!\n", args...)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotDate is the layout of snapshot file names, e.g. 2026-09-01.json.
+const snapshotDate = "2006-01-02"
+
+// pricePoint is the price charged for an item on a date.
+type pricePoint struct {
+	date  time.Time
+	price float64
+}
+
+// priceHistory holds the prices charged for each item name,
+// ordered from oldest to newest.
+type priceHistory map[string][]pricePoint
+
+// loadSnapshots reads every dated catalog snapshot in the directory
+// into a price history. The price charged is the reduced price.
+func loadSnapshots(dir string) (priceHistory, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	h := make(priceHistory)
+	for _, f := range files {
+		base := strings.TrimSuffix(filepath.Base(f), ".json")
+		date, err := time.Parse(snapshotDate, base)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s is not named by date: %v", f, err)
+		}
+		file, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		items, _, err := decodeItems(file, false)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %v", f, err)
+		}
+		for _, si := range items {
+			h[si.Name] = append(h[si.Name], pricePoint{date: date, price: si.ReducedPrice})
+		}
+	}
+	for name := range h {
+		points := h[name]
+		sort.Slice(points, func(i, j int) bool {
+			return points[i].date.Before(points[j].date)
+		})
+	}
+
+	return h, nil
+}
+
+// pricePeriod is a price and the days it was charged for.
+type pricePeriod struct {
+	price float64
+	days  int
+}
+
+// periods returns the prices charged for the item before until,
+// from oldest to newest, with how long each was charged. Each
+// snapshot's price holds until the next snapshot, and the last
+// one until until.
+func (h priceHistory) periods(name string, until time.Time) []pricePeriod {
+	points := h[name]
+	var periods []pricePeriod
+	for i, p := range points {
+		if !p.date.Before(until) {
+			break
+		}
+		end := until
+		if i+1 < len(points) && points[i+1].date.Before(until) {
+			end = points[i+1].date
+		}
+		periods = append(periods, pricePeriod{price: p.price, days: int(end.Sub(p.date).Hours() / 24)})
+	}
+
+	return periods
+}
+
+// median returns the median price charged for the item before until,
+// with each price counted for every day it was charged.
+func (h priceHistory) median(name string, until time.Time) (float64, bool) {
+	periods := h.periods(name, until)
+	total := 0
+	for _, p := range periods {
+		total += p.days
+	}
+	if total == 0 {
+		return 0, false
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].price < periods[j].price })
+	seen := 0
+	for i, p := range periods {
+		seen += p.days
+		if 2*seen < total {
+			continue
+		}
+		// When the days split evenly, the median is halfway
+		// between this price and the next one charged.
+		if 2*seen == total {
+			for _, q := range periods[i+1:] {
+				if q.days > 0 {
+					return (p.price + q.price) / 2, true
+				}
+			}
+		}
+		return p.price, true
+	}
+
+	return periods[len(periods)-1].price, true
+}
+
+// daysCharged returns for how many days right before until the item
+// was charged at least the given price without a break. Days at that
+// price before a lower price was charged do not count, so an old
+// price cannot vouch for a recent rise.
+func (h priceHistory) daysCharged(name string, price float64, until time.Time) int {
+	periods := h.periods(name, until)
+	days := 0
+	for i := len(periods) - 1; i >= 0; i-- {
+		if toCents(periods[i].price) < toCents(price) {
+			break
+		}
+		days += periods[i].days
+	}
+
+	return days
+}
+
+// saleCheck is the result of checking an item against its price history.
+type saleCheck struct {
+	Item           SaleItem
+	Median         float64
+	TrueDiscount   float64
+	DaysAtOriginal int
+	Known          bool
+	Fake           bool
+}
+
+// checkSales flags the items whose original price was charged for
+// fewer than minDays days in a row right before the sale, and works
+// out their true discount against the median price charged.
+func checkSales(items []SaleItem, h priceHistory, minDays int, at time.Time) []saleCheck {
+	checks := make([]saleCheck, 0, len(items))
+	for _, si := range items {
+		c := saleCheck{Item: si}
+		if median, ok := h.median(si.Name, at); ok {
+			c.Known = true
+			c.Median = median
+			if median > 0 {
+				c.TrueDiscount = (median - si.ReducedPrice) / median * 100
+			}
+			c.DaysAtOriginal = h.daysCharged(si.Name, si.OriginalPrice, at)
+			c.Fake = c.DaysAtOriginal < minDays
+		}
+		checks = append(checks, c)
+	}
+
+	return checks
+}
+
+// printSaleChecks prints the price history report for the items.
+func printSaleChecks(checks []saleCheck, minDays int) {
+	log.Println("Checking the BIG sale against our price history...")
+	for i, c := range checks {
+		r := c.Item
+		switch {
+		case !c.Known:
+			log.Printf("[%d]:%s has no price history.\n", i, r.Name)
+		case c.Fake:
+			log.Printf("[%d]:%s is a FAKE sale! %.2f was only charged for %d of the %d days needed. "+
+				"True discount is %.2f against a median of %.2f.\n",
+				i, r.Name, r.OriginalPrice, c.DaysAtOriginal, minDays, c.TrueDiscount, c.Median)
+		default:
+			log.Printf("[%d]:%s is a real sale. True discount is %.2f against a median of %.2f.\n",
+				i, r.Name, c.TrueDiscount, c.Median)
+		}
+	}
+}
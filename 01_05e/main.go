@@ -1,37 +1,47 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
-	"sort"
+	"time"
 )
 
 const path = "items.json"
 
 // SaleItem represents the item part of the big sale.
 type SaleItem struct {
-	Name           string  `json:"name"`
-	OriginalPrice  float64 `json:"originalPrice"`
-	ReducedPrice   float64 `json:"reducedPrice"`
-	SalePercentage float64
+	Name           string     `json:"name"`
+	OriginalPrice  float64    `json:"originalPrice"`
+	ReducedPrice   float64    `json:"reducedPrice"`
+	Category       string     `json:"category,omitempty"`
+	Brand          string     `json:"brand,omitempty"`
+	Stock          int        `json:"stock,omitempty"`
+	SKU            string     `json:"sku,omitempty"`
+	Store          string     `json:"store,omitempty"`
+	StartsAt       *time.Time `json:"startsAt,omitempty"`
+	EndsAt         *time.Time `json:"endsAt,omitempty"`
+	Currency       string     `json:"currency,omitempty"`
+	SalePercentage float64    `json:"salePercentage,omitempty"`
+	// Source is the item before its prices were converted
+	// to another currency, if they were.
+	Source *SaleItem `json:"-"`
 }
 
 // matchSales adds the sales procentage of the item
 // and sorts the array accordingly.
-func matchSales(budget float64, items []SaleItem) []SaleItem {
+// Only items whose sale is running at the given time are matched.
+func matchSales(budget float64, items []SaleItem, at time.Time) []SaleItem {
 	var mi []SaleItem
 	for _, si := range items {
-		if si.ReducedPrice <= budget {
+		if si.ReducedPrice <= budget && si.activeAt(at) {
 			si.SalePercentage = -(si.ReducedPrice - si.OriginalPrice) /
 				si.OriginalPrice * 100
 			mi = append(mi, si)
 		}
 	}
-	sort.Slice(mi, func(i, j int) bool {
-		return mi[i].SalePercentage > mi[j].SalePercentage
-	})
+	sortItems(mi, "discount")
 
 	return mi
 }
@@ -39,9 +49,128 @@ func matchSales(budget float64, items []SaleItem) []SaleItem {
 func main() {
 	budget := flag.Float64("budget", 0.0,
 		"The max budget you want to shop with.")
+	basketMode := flag.String("basket", "",
+		"Build the best basket within budget, maximizing savings or count.")
+	where := flag.String("where", "",
+		`Only show items matching the query, e.g. 'discount >= 30 && category == "kitchen"'.`)
+	sortBy := flag.String("sort", "discount",
+		"Sort the items by discount, savings, price or name.")
+	historyDir := flag.String("history", "",
+		"Check the sale against the dated catalog snapshots in this directory.")
+	minDays := flag.Int("min-days", 28,
+		"The days an original price must have been charged for a sale to be real.")
+	strict := flag.Bool("strict", true,
+		"Stop if any item in the catalog is invalid.")
+	skipInvalid := flag.Bool("skip-invalid", false,
+		"Leave invalid items out of the catalog instead of stopping. Overrides -strict.")
+	stores := flag.String("stores", "",
+		"Compare the catalogs of several stores, e.g. acme=acme.json,valuemart=valuemart.json")
+	atTime := flag.String("at", "",
+		"Match the sales running at this RFC 3339 time instead of now.")
+	upcoming := flag.Duration("upcoming", 0,
+		"List the deals within budget starting within this long, e.g. 48h.")
+	rulesFile := flag.String("rules", "",
+		"Price the cart with the promotions in this rules file, e.g. promotions.json.")
+	cart := flag.String("cart", "",
+		"The items and quantities to check out, e.g. Kettle 2000=2,Blender 1000=1")
+	coupons := flag.String("coupons", "",
+		"Comma separated coupon codes to use at checkout.")
+	ratesFile := flag.String("rates", "rates.json",
+		"The exchange rate table used by -currency.")
+	currency := flag.String("currency", "",
+		"Convert the prices and the budget from the base currency of -rates into this currency. Not allowed with -history, -rules, -stores or -serve.")
+	addr := flag.String("serve", "",
+		"Serve the deals as JSON over HTTP on this address, e.g. :8080.")
 	flag.Parse()
-	items := importData()
-	matchedItems := matchSales(*budget, items)
+	// Only the single catalog listing is converted. Snapshots,
+	// promotion amounts, other stores and the API stay in the base
+	// currency, so they cannot be mixed with converted prices.
+	if *currency != "" && (*historyDir != "" || *rulesFile != "" || *stores != "" || *addr != "") {
+		log.Fatal("-currency cannot be used with -history, -rules, -stores or -serve, which are priced in the base currency")
+	}
+	if *addr != "" {
+		c, err := newCatalog(path, *skipInvalid || !*strict)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Fatal(serve(*addr, c))
+	}
+	at, err := parseAt(*atTime)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *stores != "" {
+		files, err := parseStores(*stores)
+		if err != nil {
+			log.Fatal(err)
+		}
+		items, err := loadStores(files, *skipInvalid || !*strict)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printDeals(compareStores(*budget, activeItems(items, at)))
+		return
+	}
+	items := importData(*skipInvalid || !*strict)
+	if *currency != "" {
+		t, err := loadRates(*ratesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if items, err = convertItems(items, t, *currency); err != nil {
+			log.Fatal(err)
+		}
+		if *budget, err = t.convert(*budget, t.Base, *currency); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *historyDir != "" {
+		h, err := loadSnapshots(*historyDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printSaleChecks(checkSales(activeItems(items, at), h, *minDays, at), *minDays)
+		return
+	}
+	if *basketMode != "" {
+		obj, err := parseObjective(*basketMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printBasket(buildBasket(*budget, activeItems(items, at), obj))
+		return
+	}
+	if *rulesFile != "" {
+		rules, err := loadRules(*rulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lines, err := parseCart(*cart, activeItems(items, at))
+		if err != nil {
+			log.Fatal(err)
+		}
+		c, err := applyPromotions(lines, rules, splitList(*coupons))
+		if err != nil {
+			log.Fatal(err)
+		}
+		printCheckout(c)
+		return
+	}
+	if *upcoming > 0 {
+		printUpcoming(upcomingSales(*budget, items, at, *upcoming), at)
+		return
+	}
+	matchedItems := matchSales(*budget, items, at)
+	if *where != "" {
+		q, err := parseQuery(*where)
+		if err != nil {
+			log.Fatal(err)
+		}
+		matchedItems = q.filter(matchedItems)
+	}
+	if err := sortItems(matchedItems, *sortBy); err != nil {
+		log.Fatal(err)
+	}
 	printItems(matchedItems)
 }
 
@@ -52,24 +181,45 @@ func printItems(items []SaleItem) {
 		log.Println("No items found.:( Try increasing your budget.")
 	}
 	for i, r := range items {
+		if r.Source != nil {
+			log.Printf("[%d]:%s is %.2f OFF! Get it now for JUST %s (%s, was %s)!\n",
+				i, r.Name, r.SalePercentage, formatPrice(r.ReducedPrice, r.Currency),
+				formatPrice(r.Source.ReducedPrice, r.Source.Currency),
+				formatPrice(r.Source.OriginalPrice, r.Source.Currency))
+			continue
+		}
 		log.Printf("[%d]:%s is %.2f OFF! Get it now for JUST %.2f!\n",
 			i, r.Name, r.SalePercentage, r.ReducedPrice)
 	}
 }
 
-// importData reads the raffle entries from file and
-// creates the entries slice.
-func importData() []SaleItem {
-	file, err := os.ReadFile(path)
+// importData reads the sale items from file and
+// creates the items slice. Invalid items stop the import
+// unless skipInvalid is set, in which case they are logged and left out.
+func importData(skipInvalid bool) []SaleItem {
+	data, err := readItems(path, skipInvalid)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var data []SaleItem
-	err = json.Unmarshal(file, &data)
+	return data
+}
+
+// readItems reads and validates the catalog in the given file,
+// logging any invalid items that are skipped.
+func readItems(p string, skipInvalid bool) ([]SaleItem, error) {
+	file, err := os.ReadFile(p)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return data
+	data, skipped, err := decodeItems(file, skipInvalid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	for _, ie := range skipped {
+		log.Printf("Skipping %s %v\n", p, ie)
+	}
+
+	return data, nil
 }
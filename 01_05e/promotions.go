@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ruleType is the kind of discount a promotion gives.
+type ruleType string
+
+const (
+	percentOff ruleType = "percentOff"
+	fixedOff   ruleType = "fixedOff"
+	buyGetFree ruleType = "buyGetFree"
+	spendSave  ruleType = "spendSave"
+)
+
+// ruleTarget selects the items a promotion applies to.
+// An empty target applies to every item.
+type ruleTarget struct {
+	Names    []string `json:"names,omitempty"`
+	SKUs     []string `json:"skus,omitempty"`
+	Category string   `json:"category,omitempty"`
+	Brand    string   `json:"brand,omitempty"`
+}
+
+// matches returns whether the item is selected by the target.
+func (t ruleTarget) matches(si SaleItem) bool {
+	if len(t.Names) > 0 && !containsFold(t.Names, si.Name) {
+		return false
+	}
+	if len(t.SKUs) > 0 && !containsFold(t.SKUs, si.SKU) {
+		return false
+	}
+	if t.Category != "" && !strings.EqualFold(t.Category, si.Category) {
+		return false
+	}
+	if t.Brand != "" && !strings.EqualFold(t.Brand, si.Brand) {
+		return false
+	}
+	return true
+}
+
+// containsFold returns whether s is in list, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// promoRule is a single promotion read from the rules file.
+// Rules apply in order of priority, lowest first. An exclusive rule
+// never stacks: it is skipped if another rule already applied to the
+// same line or basket, and no later rule applies once it has. Give
+// an exclusive rule a lower priority to prefer it over the others.
+type promoRule struct {
+	Name      string     `json:"name"`
+	Type      ruleType   `json:"type"`
+	Priority  int        `json:"priority"`
+	Exclusive bool       `json:"exclusive,omitempty"`
+	Coupon    string     `json:"coupon,omitempty"`
+	Percent   float64    `json:"percent,omitempty"`
+	Amount    float64    `json:"amount,omitempty"`
+	Threshold float64    `json:"threshold,omitempty"`
+	Buy       int        `json:"buy,omitempty"`
+	Get       int        `json:"get,omitempty"`
+	AppliesTo ruleTarget `json:"appliesTo,omitempty"`
+}
+
+// validate returns an error if the rule cannot be applied.
+func (r promoRule) validate() error {
+	switch r.Type {
+	case percentOff:
+		if r.Percent <= 0 || r.Percent > 100 {
+			return fmt.Errorf("percent %.2f must be above 0 and at most 100", r.Percent)
+		}
+	case fixedOff:
+		if r.Amount <= 0 {
+			return fmt.Errorf("amount %.2f must be above zero", r.Amount)
+		}
+	case buyGetFree:
+		if r.Buy <= 0 || r.Get <= 0 {
+			return fmt.Errorf("buy %d and get %d must be above zero", r.Buy, r.Get)
+		}
+	case spendSave:
+		if r.Threshold <= 0 || r.Amount <= 0 {
+			return fmt.Errorf("threshold %.2f and amount %.2f must be above zero",
+				r.Threshold, r.Amount)
+		}
+	default:
+		return fmt.Errorf("unknown type %q: want %s, %s, %s or %s",
+			r.Type, percentOff, fixedOff, buyGetFree, spendSave)
+	}
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("name is empty")
+	}
+	return nil
+}
+
+// loadRules reads and validates the promotions in the rules file,
+// ordered by priority.
+func loadRules(p string) ([]promoRule, error) {
+	file, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var rules []promoRule
+	dec := json.NewDecoder(bytes.NewReader(file))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	for i, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("%s: rule %d (%s): %v", p, i, r.Name, err)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority < rules[j].Priority
+	})
+
+	return rules, nil
+}
+
+// adjustment is a discount given by a rule, in cents.
+type adjustment struct {
+	Rule  string
+	Cents int
+}
+
+// cartLine is a quantity of one item in the basket.
+type cartLine struct {
+	Item        SaleItem
+	Qty         int
+	Adjustments []adjustment
+	Cents       int
+}
+
+// checkout is the priced basket with every discount applied.
+type checkout struct {
+	Lines       []cartLine
+	Subtotal    int
+	Adjustments []adjustment
+	Total       int
+}
+
+// parseCart builds the basket from a comma separated list of item
+// names and quantities such as "Kettle 2000=2,Blender 1000=1".
+func parseCart(s string, items []SaleItem) ([]cartLine, error) {
+	var lines []cartLine
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, qty := field, 1
+		if i := strings.LastIndex(field, "="); i >= 0 {
+			n, err := strconv.Atoi(strings.TrimSpace(field[i+1:]))
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid quantity in %q", field)
+			}
+			name, qty = strings.TrimSpace(field[:i]), n
+		}
+		found := false
+		for _, si := range items {
+			if normalizeName(si.Name) == normalizeName(name) {
+				lines = append(lines, cartLine{Item: si, Qty: qty})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no item named %q", name)
+		}
+	}
+
+	return lines, nil
+}
+
+// applyPromotions prices the basket from the original prices and
+// applies the rules in order. Line rules apply first, then rules on
+// the basket total. Coupon rules only apply when their code is given.
+// The reduced price of every line is replaced by its final unit price.
+func applyPromotions(lines []cartLine, rules []promoRule, coupons []string) (checkout, error) {
+	for _, code := range coupons {
+		valid := false
+		for _, r := range rules {
+			if r.Coupon != "" && strings.EqualFold(r.Coupon, code) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return checkout{}, fmt.Errorf("coupon %q is not valid", code)
+		}
+	}
+	active := func(r promoRule) bool {
+		return r.Coupon == "" || containsFold(coupons, r.Coupon)
+	}
+
+	var c checkout
+	for _, l := range lines {
+		l.Adjustments = nil
+		l.Cents = toCents(l.Item.OriginalPrice) * l.Qty
+		for _, r := range rules {
+			if r.Type == spendSave || !active(r) || !r.AppliesTo.matches(l.Item) {
+				continue
+			}
+			if r.Exclusive && len(l.Adjustments) > 0 {
+				continue
+			}
+			off := lineDiscount(r, l)
+			if off <= 0 {
+				continue
+			}
+			l.Cents -= off
+			l.Adjustments = append(l.Adjustments, adjustment{Rule: r.Name, Cents: off})
+			if r.Exclusive {
+				break
+			}
+		}
+		l.Item.ReducedPrice = float64(l.Cents) / float64(l.Qty) / 100
+		c.Subtotal += l.Cents
+		c.Lines = append(c.Lines, l)
+	}
+
+	c.Total = c.Subtotal
+	for _, r := range rules {
+		if r.Type != spendSave || !active(r) || c.Subtotal < toCents(r.Threshold) {
+			continue
+		}
+		if r.Exclusive && len(c.Adjustments) > 0 {
+			continue
+		}
+		off := toCents(r.Amount)
+		if off > c.Total {
+			off = c.Total
+		}
+		c.Total -= off
+		c.Adjustments = append(c.Adjustments, adjustment{Rule: r.Name, Cents: off})
+		if r.Exclusive {
+			break
+		}
+	}
+
+	return c, nil
+}
+
+// lineDiscount returns the discount in cents the rule gives the
+// line at its current price, never more than the line costs.
+func lineDiscount(r promoRule, l cartLine) int {
+	var off int
+	switch r.Type {
+	case percentOff:
+		off = int(float64(l.Cents)*r.Percent/100 + 0.5)
+	case fixedOff:
+		off = toCents(r.Amount) * l.Qty
+	case buyGetFree:
+		free := l.Qty / (r.Buy + r.Get) * r.Get
+		off = l.Cents * free / l.Qty
+	}
+	if off > l.Cents {
+		off = l.Cents
+	}
+	return off
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// formatCents formats an amount in cents as a price.
+func formatCents(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// printCheckout prints the line by line price breakdown of the basket.
+func printCheckout(c checkout) {
+	log.Println("Your BIG sale checkout:")
+	if len(c.Lines) == 0 {
+		log.Println("Your basket is empty.")
+		return
+	}
+	for i, l := range c.Lines {
+		log.Printf("[%d]:%d x %s at %.2f = %s\n", i, l.Qty, l.Item.Name,
+			l.Item.OriginalPrice, formatCents(toCents(l.Item.OriginalPrice)*l.Qty))
+		for _, a := range l.Adjustments {
+			log.Printf("      %s -%s\n", a.Rule, formatCents(a.Cents))
+		}
+		log.Printf("      Line total %s (%.2f each)\n", formatCents(l.Cents), l.Item.ReducedPrice)
+	}
+	log.Printf("Subtotal %s\n", formatCents(c.Subtotal))
+	for _, a := range c.Adjustments {
+		log.Printf("%s -%s\n", a.Rule, formatCents(a.Cents))
+	}
+	log.Printf("Total to pay %s\n", formatCents(c.Total))
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// valueKind is the type of a value in a query expression.
+type valueKind int
+
+const (
+	numberKind valueKind = iota
+	stringKind
+	boolKind
+)
+
+// String returns the name of the kind used in error messages.
+func (k valueKind) String() string {
+	switch k {
+	case numberKind:
+		return "number"
+	case stringKind:
+		return "string"
+	}
+	return "bool"
+}
+
+// value is the result of evaluating a query expression.
+type value struct {
+	num float64
+	str string
+	b   bool
+}
+
+// field is a sale item field that queries can refer to.
+type field struct {
+	kind valueKind
+	get  func(si SaleItem) value
+}
+
+// queryFields are the sale item fields available to queries.
+var queryFields = map[string]field{
+	"name": {stringKind, func(si SaleItem) value {
+		return value{str: si.Name}
+	}},
+	"category": {stringKind, func(si SaleItem) value {
+		return value{str: si.Category}
+	}},
+	"brand": {stringKind, func(si SaleItem) value {
+		return value{str: si.Brand}
+	}},
+	"store": {stringKind, func(si SaleItem) value {
+		return value{str: si.Store}
+	}},
+	"stock": {numberKind, func(si SaleItem) value {
+		return value{num: float64(si.Stock)}
+	}},
+	"price": {numberKind, func(si SaleItem) value {
+		return value{num: si.ReducedPrice}
+	}},
+	"originalPrice": {numberKind, func(si SaleItem) value {
+		return value{num: si.OriginalPrice}
+	}},
+	"savings": {numberKind, func(si SaleItem) value {
+		return value{num: si.OriginalPrice - si.ReducedPrice}
+	}},
+	"discount": {numberKind, func(si SaleItem) value {
+		return value{num: si.SalePercentage}
+	}},
+}
+
+// QueryError reports a problem with a query and where it is.
+type QueryError struct {
+	Pos int
+	Msg string
+}
+
+// Error returns the message with the 1-based column of the problem.
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("query error at column %d: %s", e.Pos+1, e.Msg)
+}
+
+// node is a type checked part of a query expression.
+type node interface {
+	kind() valueKind
+	eval(si SaleItem) value
+}
+
+// literal is a constant in the query.
+type literal struct {
+	k valueKind
+	v value
+}
+
+func (n literal) kind() valueKind     { return n.k }
+func (n literal) eval(SaleItem) value { return n.v }
+
+// fieldRef reads a sale item field.
+type fieldRef struct {
+	f field
+}
+
+func (n fieldRef) kind() valueKind        { return n.f.kind }
+func (n fieldRef) eval(si SaleItem) value { return n.f.get(si) }
+
+// unary applies ! or - to its operand.
+type unary struct {
+	op string
+	x  node
+}
+
+func (n unary) kind() valueKind { return n.x.kind() }
+func (n unary) eval(si SaleItem) value {
+	v := n.x.eval(si)
+	if n.op == "!" {
+		return value{b: !v.b}
+	}
+	return value{num: -v.num}
+}
+
+// binary applies a comparison or logical operator to its operands.
+type binary struct {
+	op   string
+	l, r node
+}
+
+func (n binary) kind() valueKind { return boolKind }
+func (n binary) eval(si SaleItem) value {
+	switch n.op {
+	case "&&":
+		return value{b: n.l.eval(si).b && n.r.eval(si).b}
+	case "||":
+		return value{b: n.l.eval(si).b || n.r.eval(si).b}
+	}
+	l, r := n.l.eval(si), n.r.eval(si)
+	var cmp int
+	switch n.l.kind() {
+	case numberKind:
+		switch {
+		case l.num < r.num:
+			cmp = -1
+		case l.num > r.num:
+			cmp = 1
+		}
+	case stringKind:
+		cmp = strings.Compare(strings.ToLower(l.str), strings.ToLower(r.str))
+	case boolKind:
+		if l.b != r.b {
+			cmp = 1
+		}
+	}
+	switch n.op {
+	case "==":
+		return value{b: cmp == 0}
+	case "!=":
+		return value{b: cmp != 0}
+	case "<":
+		return value{b: cmp < 0}
+	case "<=":
+		return value{b: cmp <= 0}
+	case ">":
+		return value{b: cmp > 0}
+	}
+	return value{b: cmp >= 0}
+}
+
+// query is a compiled filter over sale items.
+type query struct {
+	root node
+}
+
+// match returns whether the item satisfies the query.
+func (q *query) match(si SaleItem) bool {
+	return q.root.eval(si).b
+}
+
+// filter returns the items that satisfy the query.
+func (q *query) filter(items []SaleItem) []SaleItem {
+	var mi []SaleItem
+	for _, si := range items {
+		if q.match(si) {
+			mi = append(mi, si)
+		}
+	}
+	return mi
+}
+
+// tokenKind is the type of a query token.
+type tokenKind int
+
+const (
+	eofToken tokenKind = iota
+	identToken
+	numberToken
+	stringToken
+	opToken
+)
+
+// token is a lexed piece of a query.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lexQuery splits the query source into tokens.
+func lexQuery(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) ||
+				unicode.IsDigit(rune(src[j])) || src[j] == '_') {
+				j++
+			}
+			toks = append(toks, token{identToken, src[i:j], i})
+			i = j
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{numberToken, src[i:j], i})
+			i = j
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for j < len(src) && rune(src[j]) != c {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+				j++
+			}
+			if j >= len(src) {
+				return nil, &QueryError{i, "unterminated string"}
+			}
+			toks = append(toks, token{stringToken, sb.String(), i})
+			i = j + 1
+		default:
+			op := ""
+			for _, o := range []string{"&&", "||", "==", "!=", "<=", ">=",
+				"<", ">", "!", "(", ")", "-"} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &QueryError{i, fmt.Sprintf("unexpected character %q", c)}
+			}
+			toks = append(toks, token{opToken, op, i})
+			i += len(op)
+		}
+	}
+
+	return append(toks, token{eofToken, "", len(src)}), nil
+}
+
+// parser builds a query from its tokens by recursive descent.
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// parseQuery compiles the query source, checking that every
+// field exists and that operands have matching types.
+func parseQuery(src string) (*query, error) {
+	toks, err := lexQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != eofToken {
+		return nil, &QueryError{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+	}
+	if root.kind() != boolKind {
+		return nil, &QueryError{0, fmt.Sprintf("query is a %s, not a condition", root.kind())}
+	}
+
+	return &query{root: root}, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != eofToken {
+		p.pos++
+	}
+	return t
+}
+
+// isOp returns whether the next token is one of the operators.
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != opToken {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) or() (node, error) {
+	return p.logical("||", p.and)
+}
+
+func (p *parser) and() (node, error) {
+	return p.logical("&&", p.not)
+}
+
+// logical parses operands joined by the operator, which must all be conditions.
+func (p *parser) logical(op string, operand func() (node, error)) (node, error) {
+	start := p.peek().pos
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(op) {
+		t := p.next()
+		rstart := p.peek().pos
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if l.kind() != boolKind {
+			return nil, &QueryError{start, fmt.Sprintf("%s needs a condition, found a %s", op, l.kind())}
+		}
+		if r.kind() != boolKind {
+			return nil, &QueryError{rstart, fmt.Sprintf("%s needs a condition, found a %s", op, r.kind())}
+		}
+		l = binary{op: t.text, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) not() (node, error) {
+	if p.isOp("!") {
+		t := p.next()
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		if x.kind() != boolKind {
+			return nil, &QueryError{t.pos, fmt.Sprintf("! needs a condition, found a %s", x.kind())}
+		}
+		return unary{op: "!", x: x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	l, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("==", "!=", "<", "<=", ">", ">=") {
+		return l, nil
+	}
+	t := p.next()
+	r, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if l.kind() != r.kind() {
+		return nil, &QueryError{t.pos, fmt.Sprintf("cannot compare %s with %s", l.kind(), r.kind())}
+	}
+	if l.kind() == boolKind && t.text != "==" && t.text != "!=" {
+		return nil, &QueryError{t.pos, fmt.Sprintf("cannot use %s on conditions", t.text)}
+	}
+	return binary{op: t.text, l: l, r: r}, nil
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case numberToken:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &QueryError{t.pos, fmt.Sprintf("invalid number %q", t.text)}
+		}
+		return literal{numberKind, value{num: n}}, nil
+	case stringToken:
+		return literal{stringKind, value{str: t.text}}, nil
+	case identToken:
+		switch t.text {
+		case "true":
+			return literal{boolKind, value{b: true}}, nil
+		case "false":
+			return literal{boolKind, value{b: false}}, nil
+		}
+		f, ok := queryFields[t.text]
+		if !ok {
+			return nil, &QueryError{t.pos, fmt.Sprintf("unknown field %q, want one of %s",
+				t.text, strings.Join(queryFieldNames(), ", "))}
+		}
+		return fieldRef{f}, nil
+	case opToken:
+		switch t.text {
+		case "(":
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOp(")") {
+				return nil, &QueryError{p.peek().pos, "missing )"}
+			}
+			p.next()
+			return x, nil
+		case "-":
+			x, err := p.primary()
+			if err != nil {
+				return nil, err
+			}
+			if x.kind() != numberKind {
+				return nil, &QueryError{t.pos, fmt.Sprintf("cannot negate a %s", x.kind())}
+			}
+			return unary{op: "-", x: x}, nil
+		}
+	case eofToken:
+		return nil, &QueryError{t.pos, "unexpected end of query"}
+	}
+	return nil, &QueryError{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+}
+
+// queryFieldNames returns the sorted names of the query fields.
+func queryFieldNames() []string {
+	names := make([]string, 0, len(queryFields))
+	for name := range queryFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// itemLess returns the order of the given sort key. Savings and
+// discount sort from highest to lowest, while price and name sort
+// from lowest to highest. Ties are broken by name, store and SKU,
+// so the order is the same however the items were ordered before.
+func itemLess(key string) (func(a, b SaleItem) bool, error) {
+	var less func(a, b SaleItem) bool
+	switch key {
+	case "discount":
+		less = func(a, b SaleItem) bool { return a.SalePercentage > b.SalePercentage }
+	case "savings":
+		less = func(a, b SaleItem) bool {
+			return a.OriginalPrice-a.ReducedPrice > b.OriginalPrice-b.ReducedPrice
+		}
+	case "price":
+		less = func(a, b SaleItem) bool { return a.ReducedPrice < b.ReducedPrice }
+	case "name":
+		less = func(a, b SaleItem) bool { return a.Name < b.Name }
+	default:
+		return nil, fmt.Errorf("unknown sort key %q: want discount, savings, price or name", key)
+	}
+	return func(a, b SaleItem) bool {
+		switch {
+		case less(a, b):
+			return true
+		case less(b, a):
+			return false
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		case a.Store != b.Store:
+			return a.Store < b.Store
+		}
+		return a.SKU < b.SKU
+	}, nil
+}
+
+// sortItems sorts the items by the given key, as ordered by itemLess.
+func sortItems(items []SaleItem, key string) error {
+	less, err := itemLess(key)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return less(items[i], items[j])
+	})
+
+	return nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// API paging limits for the deals endpoint.
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// catalog is the sale catalog served by the API. It reloads
+// itself when the file on disk changes.
+type catalog struct {
+	mu          sync.RWMutex
+	path        string
+	skipInvalid bool
+	items       []SaleItem
+	modTime     time.Time
+}
+
+// newCatalog loads the catalog from the given file.
+func newCatalog(p string, skipInvalid bool) (*catalog, error) {
+	c := &catalog{path: p, skipInvalid: skipInvalid}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload reads the catalog file again if it changed since it was
+// last read. The current items are kept if the new file is invalid.
+func (c *catalog) reload() (bool, error) {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := info.ModTime().Equal(c.modTime)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	items, err := readItems(c.path, c.skipInvalid)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = items
+	c.modTime = info.ModTime()
+
+	return true, nil
+}
+
+// watch checks the catalog file for changes at every interval
+// until done is closed.
+func (c *catalog) watch(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := c.reload()
+			if err != nil {
+				log.Printf("Keeping the current catalog: %v\n", err)
+				continue
+			}
+			if reloaded {
+				log.Printf("Reloaded the catalog from %s.\n", c.path)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// snapshot returns the items currently in the catalog.
+func (c *catalog) snapshot() []SaleItem {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.items
+}
+
+// dealsPage is a page of deals returned by the API.
+type dealsPage struct {
+	Items      []SaleItem `json:"items"`
+	Total      int        `json:"total"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// apiError is the body of an API error response.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// handleDeals serves the matching sales as JSON. It supports the
+// budget, minDiscount, sort, limit and cursor query parameters,
+// and answers 304 Not Modified when the ETag has not changed.
+// Without a budget, every deal is matched.
+func (c *catalog) handleDeals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+		return
+	}
+	q := r.URL.Query()
+	budget, err := floatParam(q.Get("budget"), math.Inf(1))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{fmt.Sprintf("budget: %v", err)})
+		return
+	}
+	minDiscount, err := floatParam(q.Get("minDiscount"), 0)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{fmt.Sprintf("minDiscount: %v", err)})
+		return
+	}
+	limit, err := intParam(q.Get("limit"), defaultLimit)
+	if err != nil || limit <= 0 || limit > maxLimit {
+		writeJSON(w, http.StatusBadRequest,
+			apiError{fmt.Sprintf("limit must be between 1 and %d", maxLimit)})
+		return
+	}
+	sortBy := q.Get("sort")
+	if sortBy == "" {
+		sortBy = "discount"
+	}
+	less, err := itemLess(sortBy)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{err.Error()})
+		return
+	}
+	cur, err := decodeCursor(q.Get("cursor"))
+	if err != nil || (cur != nil && cur.Sort != sortBy) {
+		writeJSON(w, http.StatusBadRequest, apiError{"invalid cursor"})
+		return
+	}
+
+	var deals []SaleItem
+	for _, si := range matchSales(budget, c.snapshot(), time.Now()) {
+		if si.SalePercentage >= minDiscount {
+			deals = append(deals, si)
+		}
+	}
+	sort.SliceStable(deals, func(i, j int) bool { return less(deals[i], deals[j]) })
+
+	// The page starts after the last deal of the previous page, wherever
+	// it is now, so a reload between pages neither skips nor repeats deals.
+	start := 0
+	if cur != nil {
+		last := cur.item()
+		start = sort.Search(len(deals), func(i int) bool { return less(last, deals[i]) })
+	}
+	page := dealsPage{Items: []SaleItem{}, Total: len(deals)}
+	if start < len(deals) {
+		end := start + limit
+		if end < len(deals) {
+			page.NextCursor = encodeCursor(sortBy, deals[end-1])
+		} else {
+			end = len(deals)
+		}
+		page.Items = deals[start:end]
+	}
+
+	body, err := json.Marshal(page)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{err.Error()})
+		return
+	}
+	h := fnv.New64a()
+	h.Write(body)
+	etag := fmt.Sprintf(`"%x"`, h.Sum64())
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(body)
+	}
+}
+
+// writeJSON writes v as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Could not write response: %v\n", err)
+	}
+}
+
+// floatParam parses a float query parameter, using def when it is empty.
+func floatParam(s string, def float64) (float64, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// intParam parses an int query parameter, using def when it is empty.
+func intParam(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// dealsCursor is the last deal of a page and the order it was in.
+// It holds every field the order looks at.
+type dealsCursor struct {
+	Sort           string  `json:"sort"`
+	Name           string  `json:"name"`
+	Store          string  `json:"store,omitempty"`
+	SKU            string  `json:"sku,omitempty"`
+	OriginalPrice  float64 `json:"originalPrice"`
+	ReducedPrice   float64 `json:"reducedPrice"`
+	SalePercentage float64 `json:"salePercentage"`
+}
+
+// item returns the deal the cursor points after.
+func (c *dealsCursor) item() SaleItem {
+	return SaleItem{Name: c.Name, Store: c.Store, SKU: c.SKU, OriginalPrice: c.OriginalPrice,
+		ReducedPrice: c.ReducedPrice, SalePercentage: c.SalePercentage}
+}
+
+// encodeCursor returns the opaque cursor for the page after the deal.
+func encodeCursor(sortBy string, si SaleItem) string {
+	b, _ := json.Marshal(dealsCursor{Sort: sortBy, Name: si.Name, Store: si.Store, SKU: si.SKU,
+		OriginalPrice: si.OriginalPrice, ReducedPrice: si.ReducedPrice,
+		SalePercentage: si.SalePercentage})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns the deal the cursor points after. An empty
+// cursor is the first page, and has no deal.
+func decodeCursor(cursor string) (*dealsCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var c dealsCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	return &c, nil
+}
+
+// serve starts the deals API on the given address, reloading
+// the catalog whenever its file changes.
+func serve(addr string, c *catalog) error {
+	done := make(chan struct{})
+	defer close(done)
+	go c.watch(time.Second, done)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deals", c.handleDeals)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Printf("Serving the BIG sale deals on %s/deals\n", addr)
+
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// storeFile is a catalog file belonging to a store.
+type storeFile struct {
+	store string
+	path  string
+}
+
+// parseStores parses a comma separated list of stores and their
+// catalog files such as "acme=acme.json,valuemart=valuemart.json".
+func parseStores(s string) ([]storeFile, error) {
+	var files []storeFile
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid store %q: want store=file", field)
+		}
+		files = append(files, storeFile{store: parts[0], path: parts[1]})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no stores given")
+	}
+
+	return files, nil
+}
+
+// loadStores reads the catalog of every store and tags
+// each item with the store it came from.
+func loadStores(files []storeFile, skipInvalid bool) ([]SaleItem, error) {
+	var items []SaleItem
+	for _, f := range files {
+		data, err := readItems(f.path, skipInvalid)
+		if err != nil {
+			return nil, err
+		}
+		for _, si := range data {
+			si.Store = f.store
+			items = append(items, si)
+		}
+	}
+
+	return items, nil
+}
+
+// normalizeName folds the name to lower case letters and digits
+// separated by single spaces, so "Kettle-2000 " matches "kettle 2000".
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// productSKU returns the SKU of the item folded to lower case,
+// or "" if it has none.
+func productSKU(si SaleItem) string {
+	return strings.ToLower(strings.TrimSpace(si.SKU))
+}
+
+// groupProducts groups the items that are the same product. Items
+// with a SKU are the same product when their SKUs match, whatever
+// their names. Items without one are the same product when their
+// names match, and join the product with a SKU of that name when
+// there is only one, so two different SKUs are never grouped. Groups
+// are in the order their first item appears.
+func groupProducts(items []SaleItem) [][]SaleItem {
+	parent := make([]int, len(items))
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	// The root with the lower index keeps the group in the
+	// order its first item appears.
+	union := func(i, j int) {
+		ri, rj := find(i), find(j)
+		if ri < rj {
+			parent[rj] = ri
+		} else {
+			parent[ri] = rj
+		}
+	}
+
+	bySKU := make(map[string]int)
+	byName := make(map[string]int)
+	for i, si := range items {
+		parent[i] = i
+		key, owner := productSKU(si), bySKU
+		if key == "" {
+			key, owner = normalizeName(si.Name), byName
+		}
+		if j, ok := owner[key]; ok {
+			union(i, j)
+		} else {
+			owner[key] = i
+		}
+	}
+	skuGroups := make(map[string]map[int]bool)
+	for i, si := range items {
+		if productSKU(si) == "" {
+			continue
+		}
+		name := normalizeName(si.Name)
+		if skuGroups[name] == nil {
+			skuGroups[name] = make(map[int]bool)
+		}
+		skuGroups[name][find(i)] = true
+	}
+	for name, i := range byName {
+		if g := skuGroups[name]; len(g) == 1 {
+			for r := range g {
+				union(i, r)
+			}
+		}
+	}
+
+	var groups [][]SaleItem
+	index := make(map[int]int)
+	for i, si := range items {
+		r := find(i)
+		g, ok := index[r]
+		if !ok {
+			g = len(groups)
+			index[r] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], si)
+	}
+
+	return groups
+}
+
+// productDeal is the best offer for a product across stores.
+type productDeal struct {
+	Best           SaleItem
+	Others         []SaleItem
+	LowestOriginal float64
+}
+
+// compareStores groups the items by product and picks the cheapest
+// offer for each one within the budget. The sale percentage is worked
+// out against the lowest original price across all stores.
+func compareStores(budget float64, items []SaleItem) []productDeal {
+	var deals []productDeal
+	for _, o := range groupProducts(items) {
+		sort.SliceStable(o, func(i, j int) bool {
+			if o[i].ReducedPrice != o[j].ReducedPrice {
+				return o[i].ReducedPrice < o[j].ReducedPrice
+			}
+			return o[i].Store < o[j].Store
+		})
+		if o[0].ReducedPrice > budget {
+			continue
+		}
+		lowest := o[0].OriginalPrice
+		for _, si := range o[1:] {
+			if si.OriginalPrice < lowest {
+				lowest = si.OriginalPrice
+			}
+		}
+		best := o[0]
+		best.SalePercentage = -(best.ReducedPrice - lowest) / lowest * 100
+		deals = append(deals, productDeal{
+			Best:           best,
+			Others:         o[1:],
+			LowestOriginal: lowest,
+		})
+	}
+	sort.SliceStable(deals, func(i, j int) bool {
+		return deals[i].Best.SalePercentage > deals[j].Best.SalePercentage
+	})
+
+	return deals
+}
+
+// printDeals prints the best deal for each product with
+// the prices of the other stores next to it.
+func printDeals(deals []productDeal) {
+	log.Println("The BIG sale has started across all our stores!")
+	if len(deals) == 0 {
+		log.Println("No items found.:( Try increasing your budget.")
+	}
+	for i, d := range deals {
+		r := d.Best
+		var others []string
+		for _, o := range d.Others {
+			others = append(others, fmt.Sprintf("%s %.2f", o.Store, o.ReducedPrice))
+		}
+		line := fmt.Sprintf("[%d]:%s is %.2f OFF at %s! Get it now for JUST %.2f!",
+			i, r.Name, r.SalePercentage, r.Store, r.ReducedPrice)
+		if len(others) > 0 {
+			line += fmt.Sprintf(" (elsewhere: %s)", strings.Join(others, ", "))
+		}
+		log.Println(line)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ItemError reports an invalid item and its index in the catalog.
+type ItemError struct {
+	Index int
+	Name  string
+	Err   error
+}
+
+// Error returns the message with the index and name of the item.
+func (e *ItemError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("item %d (%s): %v", e.Index, e.Name, e.Err)
+}
+
+// Unwrap returns the underlying validation error.
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is every invalid item found in a catalog.
+type ValidationErrors []*ItemError
+
+// Error lists every invalid item.
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ie := range e {
+		msgs[i] = ie.Error()
+	}
+	return fmt.Sprintf("%d invalid items: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// validate returns an error if the item cannot be part of the sale.
+func (si SaleItem) validate() error {
+	switch {
+	case strings.TrimSpace(si.Name) == "":
+		return errors.New("name is empty")
+	case si.OriginalPrice <= 0:
+		return fmt.Errorf("originalPrice %.2f must be above zero", si.OriginalPrice)
+	case si.ReducedPrice < 0:
+		return fmt.Errorf("reducedPrice %.2f cannot be negative", si.ReducedPrice)
+	case si.ReducedPrice > si.OriginalPrice:
+		return fmt.Errorf("reducedPrice %.2f is above originalPrice %.2f",
+			si.ReducedPrice, si.OriginalPrice)
+	case si.Stock < 0:
+		return fmt.Errorf("stock %d cannot be negative", si.Stock)
+	case si.StartsAt != nil && si.EndsAt != nil && !si.EndsAt.After(*si.StartsAt):
+		return fmt.Errorf("endsAt %s is not after startsAt %s",
+			si.EndsAt.Format(time.RFC3339), si.StartsAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// decodeItems strictly decodes and validates a catalog. Unknown
+// fields and invalid items are reported with their index. When
+// skipInvalid is set, invalid items are left out and returned as
+// skipped instead of failing the whole catalog.
+func decodeItems(data []byte, skipInvalid bool) ([]SaleItem, ValidationErrors, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	var items []SaleItem
+	var invalid ValidationErrors
+	for i, r := range raw {
+		var si SaleItem
+		dec := json.NewDecoder(bytes.NewReader(r))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&si)
+		if err == nil {
+			err = si.validate()
+		}
+		if err != nil {
+			invalid = append(invalid, &ItemError{Index: i, Name: si.Name, Err: err})
+			continue
+		}
+		items = append(items, si)
+	}
+	if len(invalid) > 0 && !skipInvalid {
+		return nil, nil, invalid
+	}
+
+	return items, invalid, nil
+}
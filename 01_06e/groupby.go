@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// noValue is the group key of records that do not have the field.
+const noValue = "(none)"
+
+// record is a user record with all of its fields, however nested.
+type record map[string]interface{}
+
+// importRecords reads the users from file as generic records.
+func importRecords() ([]record, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var data []record
+	if err := json.Unmarshal(file, &data); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return data, nil
+}
+
+// lookup returns the value at the dot separated path, such as plan.tier.
+func (r record) lookup(path string) (interface{}, bool) {
+	var v interface{} = map[string]interface{}(r)
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[part]; !ok || v == nil {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// keySpec is a field to group records by. Time fields can be
+// truncated to their year, quarter, month, week or day.
+type keySpec struct {
+	path string
+	unit string
+}
+
+// parseKeys parses comma separated group keys such as
+// "country,plan.tier" or "signedUpAt:month".
+func parseKeys(s string) ([]keySpec, error) {
+	var keys []keySpec
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		k := keySpec{path: field}
+		if i := strings.Index(field, ":"); i >= 0 {
+			k.path, k.unit = field[:i], field[i+1:]
+			if _, err := bucketTime(time.Time{}, k.unit); err != nil {
+				return nil, fmt.Errorf("group key %q: %v", field, err)
+			}
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no group keys given")
+	}
+
+	return keys, nil
+}
+
+// String returns the key as it was written.
+func (k keySpec) String() string {
+	if k.unit == "" {
+		return k.path
+	}
+	return k.path + ":" + k.unit
+}
+
+// value returns the group key of the record.
+func (k keySpec) value(r record) (string, error) {
+	v, ok := r.lookup(k.path)
+	if !ok {
+		return noValue, nil
+	}
+	s := formatValue(v)
+	if k.unit == "" {
+		return s, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return "", fmt.Errorf("%s is not an RFC 3339 time: %q", k.path, s)
+	}
+	return bucketTime(t, k.unit)
+}
+
+// bucketTime formats the time truncated to the given unit.
+func bucketTime(t time.Time, unit string) (string, error) {
+	t = t.UTC()
+	switch unit {
+	case "year":
+		return t.Format("2006"), nil
+	case "quarter":
+		return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1), nil
+	case "month":
+		return t.Format("2006-01"), nil
+	case "week":
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w), nil
+	case "day":
+		return t.Format("2006-01-02"), nil
+	}
+	return "", fmt.Errorf("unknown time unit %q: want year, quarter, month, week or day", unit)
+}
+
+// formatValue formats a JSON value as a group key.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// aggregate is what is worked out for each group: the count of
+// records, the count of distinct values of a field, or the sum of
+// a numeric field.
+type aggregate struct {
+	kind string
+	path string
+}
+
+// parseAggregate parses an aggregate such as count,
+// distinct:id or sum:plan.seats.
+func parseAggregate(s string) (aggregate, error) {
+	kind, path := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		kind, path = s[:i], s[i+1:]
+	}
+	switch {
+	case kind == "count" && path == "":
+		return aggregate{kind: kind}, nil
+	case (kind == "distinct" || kind == "sum") && path != "":
+		return aggregate{kind: kind, path: path}, nil
+	}
+	return aggregate{}, fmt.Errorf("unknown aggregate %q: want count, distinct:field or sum:field", s)
+}
+
+// String returns the aggregate as it was written.
+func (a aggregate) String() string {
+	if a.path == "" {
+		return a.kind
+	}
+	return a.kind + ":" + a.path
+}
+
+// groupRow is the aggregate of one group of records.
+type groupRow struct {
+	keys  []string
+	value float64
+}
+
+// groupBy groups the records by the keys and works out the
+// aggregate for every group. Rows are ordered by their keys.
+func groupBy(records []record, keys []keySpec, agg aggregate) ([]groupRow, error) {
+	type group struct {
+		keys     []string
+		value    float64
+		distinct map[string]struct{}
+	}
+	groups := make(map[string]*group)
+	for i, r := range records {
+		kv := make([]string, len(keys))
+		for j, k := range keys {
+			v, err := k.value(r)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %v", i, err)
+			}
+			kv[j] = v
+		}
+		id := strings.Join(kv, "\x00")
+		g, ok := groups[id]
+		if !ok {
+			g = &group{keys: kv, distinct: make(map[string]struct{})}
+			groups[id] = g
+		}
+
+		switch agg.kind {
+		case "count":
+			g.value++
+		case "distinct":
+			if v, ok := r.lookup(agg.path); ok {
+				g.distinct[formatValue(v)] = struct{}{}
+				g.value = float64(len(g.distinct))
+			}
+		case "sum":
+			v, ok := r.lookup(agg.path)
+			if !ok {
+				continue
+			}
+			n, err := toNumber(v)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %s: %v", i, agg.path, err)
+			}
+			g.value += n
+		}
+	}
+
+	rows := make([]groupRow, 0, len(groups))
+	for _, g := range groups {
+		rows = append(rows, groupRow{keys: g.keys, value: g.value})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		for k := range rows[i].keys {
+			if rows[i].keys[k] != rows[j].keys[k] {
+				return rows[i].keys[k] < rows[j].keys[k]
+			}
+		}
+		return false
+	})
+
+	return rows, nil
+}
+
+// toNumber returns the JSON value as a number.
+func toNumber(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("%s is not a number", formatValue(v))
+}
+
+// writePivot writes the groups as a table. With two keys the
+// second key becomes the columns of a pivot table, otherwise
+// every group is a row.
+func writePivot(w io.Writer, rows []groupRow, keys []keySpec, agg aggregate) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if len(keys) != 2 {
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%s\t", k)
+		}
+		fmt.Fprintf(tw, "%s\t\n", agg)
+		for _, r := range rows {
+			for _, k := range r.keys {
+				fmt.Fprintf(tw, "%s\t", k)
+			}
+			fmt.Fprintf(tw, "%s\t\n", formatNumber(r.value))
+		}
+		return tw.Flush()
+	}
+
+	var rowKeys, colKeys []string
+	cells := make(map[[2]string]float64)
+	rowTotals := make(map[string]float64)
+	colTotals := make(map[string]float64)
+	total := 0.0
+	for _, r := range rows {
+		rk, ck := r.keys[0], r.keys[1]
+		if _, ok := rowTotals[rk]; !ok {
+			rowKeys = append(rowKeys, rk)
+		}
+		if _, ok := colTotals[ck]; !ok {
+			colKeys = append(colKeys, ck)
+		}
+		cells[[2]string{rk, ck}] = r.value
+		rowTotals[rk] += r.value
+		colTotals[ck] += r.value
+		total += r.value
+	}
+	sort.Strings(colKeys)
+
+	// Totals of distinct counts would count values once per group,
+	// so they are only shown for counts and sums.
+	totals := agg.kind != "distinct"
+	fmt.Fprintf(tw, "%s \\ %s\t", keys[0], keys[1])
+	for _, ck := range colKeys {
+		fmt.Fprintf(tw, "%s\t", ck)
+	}
+	if totals {
+		fmt.Fprint(tw, "total\t")
+	}
+	fmt.Fprintln(tw)
+	for _, rk := range rowKeys {
+		fmt.Fprintf(tw, "%s\t", rk)
+		for _, ck := range colKeys {
+			fmt.Fprintf(tw, "%s\t", formatNumber(cells[[2]string{rk, ck}]))
+		}
+		if totals {
+			fmt.Fprintf(tw, "%s\t", formatNumber(rowTotals[rk]))
+		}
+		fmt.Fprintln(tw)
+	}
+	if totals {
+		fmt.Fprint(tw, "total\t")
+		for _, ck := range colKeys {
+			fmt.Fprintf(tw, "%s\t", formatNumber(colTotals[ck]))
+		}
+		fmt.Fprintf(tw, "%s\t\n", formatNumber(total))
+	}
+
+	return tw.Flush()
+}
+
+// formatNumber formats an aggregate without trailing zeros.
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
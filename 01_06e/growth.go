@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// sparkBars are the bars of a sparkline from lowest to highest.
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// marketGrowth is the signups of a country in every period.
+type marketGrowth struct {
+	Country string
+	Counts  []int
+	// Growth is the percentage change from the previous period to
+	// the latest one. It is infinite when the previous period had no signups.
+	Growth float64
+}
+
+// periodStart returns the start of the week, month or quarter the time is in.
+func periodStart(t time.Time, unit string) (time.Time, error) {
+	t = t.UTC()
+	y, m, d := t.Date()
+	switch unit {
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, time.UTC), nil
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC), nil
+	case "quarter":
+		return time.Date(y, m-(m-1)%3, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown growth period %q: want week, month or quarter", unit)
+}
+
+// nextPeriod returns the start of the period after the one starting at t.
+func nextPeriod(t time.Time, unit string) time.Time {
+	switch unit {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "quarter":
+		return t.AddDate(0, 3, 0)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+// growthByCountry buckets the signups of every country into
+// consecutive periods from the first signup to the last one.
+// Users without a signup time are counted and left out.
+func growthByCountry(users []User, unit string) ([]string, []marketGrowth, int, error) {
+	if _, err := periodStart(time.Time{}, unit); err != nil {
+		return nil, nil, 0, err
+	}
+	var first, last time.Time
+	skipped := 0
+	for _, u := range users {
+		if u.SignedUpAt == nil {
+			skipped++
+			continue
+		}
+		start, _ := periodStart(*u.SignedUpAt, unit)
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+	if first.IsZero() {
+		return nil, nil, skipped, nil
+	}
+
+	var periods []string
+	index := make(map[time.Time]int)
+	for p := first; !p.After(last); p = nextPeriod(p, unit) {
+		label, _ := bucketTime(p, unit)
+		index[p] = len(periods)
+		periods = append(periods, label)
+	}
+
+	counts := make(map[string][]int)
+	for _, u := range users {
+		if u.SignedUpAt == nil {
+			continue
+		}
+		start, _ := periodStart(*u.SignedUpAt, unit)
+		if counts[u.Country] == nil {
+			counts[u.Country] = make([]int, len(periods))
+		}
+		counts[u.Country][index[start]]++
+	}
+
+	growths := make([]marketGrowth, 0, len(counts))
+	for country, c := range counts {
+		g := marketGrowth{Country: country, Counts: c}
+		if n := len(c); n >= 2 {
+			prev, cur := c[n-2], c[n-1]
+			switch {
+			case prev > 0:
+				g.Growth = float64(cur-prev) / float64(prev) * 100
+			case cur > 0:
+				g.Growth = math.Inf(1)
+			}
+		}
+		growths = append(growths, g)
+	}
+	sort.Slice(growths, func(i, j int) bool {
+		gi, gj := growths[i], growths[j]
+		if gi.Growth != gj.Growth {
+			return gi.Growth > gj.Growth
+		}
+		li, lj := gi.Counts[len(gi.Counts)-1], gj.Counts[len(gj.Counts)-1]
+		if li != lj {
+			return li > lj
+		}
+		return gi.Country < gj.Country
+	})
+
+	return periods, growths, skipped, nil
+}
+
+// sparkline draws the counts as a line of bars scaled to the highest count.
+func sparkline(counts []int) string {
+	top := 0
+	for _, c := range counts {
+		if c > top {
+			top = c
+		}
+	}
+	line := make([]rune, len(counts))
+	for i, c := range counts {
+		if top == 0 {
+			line[i] = sparkBars[0]
+			continue
+		}
+		line[i] = sparkBars[c*(len(sparkBars)-1)/top]
+	}
+	return string(line)
+}
+
+// formatGrowth formats a growth rate as a signed percentage.
+func formatGrowth(g float64) string {
+	if math.IsInf(g, 1) {
+		return "up from 0"
+	}
+	return fmt.Sprintf("%+.1f%%", g)
+}
+
+// writeGrowth writes the growth of every market from the fastest
+// growing to the slowest, with a sparkline of its signups.
+func writeGrowth(w io.Writer, periods []string, growths []marketGrowth) error {
+	if len(periods) == 0 {
+		_, err := fmt.Fprintln(w, "No signups found.")
+		return err
+	}
+	fmt.Fprintf(w, "Signups from %s to %s\n", periods[0], periods[len(periods)-1])
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Country\tSignups\tLatest\tGrowth\tTrend")
+	for _, g := range growths {
+		total := 0
+		for _, c := range g.Counts {
+			total += c
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", g.Country, total,
+			g.Counts[len(g.Counts)-1], formatGrowth(g.Growth), sparkline(g.Counts))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(periods) >= 2 && len(growths) > 0 {
+		_, err := fmt.Fprintf(w, "The fastest-growing market is %s (%s in %s).\n",
+			growths[0].Country, formatGrowth(growths[0].Growth), periods[len(periods)-1])
+		return err
+	}
+	return nil
+}
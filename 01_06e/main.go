@@ -2,43 +2,224 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"log"
 	"os"
+	"runtime"
+	"time"
 )
 
 // User represents a user record.
 type User struct {
-	Name    string `json:"name"`
-	Country string `json:"country"`
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Country    string     `json:"country"`
+	SignedUpAt *time.Time `json:"signedUpAt,omitempty"`
 }
 
 const path = "users.json"
 
 // getBiggestMarket takes in the slice of users and
-// returns the biggest market.
+// returns the biggest market. Ties go to the country
+// whose name sorts first.
 func getBiggestMarket(users []User) (string, int) {
+	ranks := rankCounts(countMarkets(users))
+	if len(ranks) == 0 {
+		return "", 0
+	}
+
+	return ranks[0].Country, ranks[0].Count
+}
+
+// countMarkets counts the users in each country.
+func countMarkets(users []User) map[string]int {
 	counts := make(map[string]int)
 	for _, u := range users {
 		counts[u.Country]++
 	}
 
-	maxCountry := ""
-	maxCount := 0
-	for country, count := range counts {
-		if count > maxCount {
-			maxCount = count
-			maxCountry = country
+	return counts
+}
+
+func main() {
+	top := flag.Int("top", 0,
+		"Print a ranking of the top markets instead of only the biggest, 0 for none.")
+	format := flag.String("format", "",
+		"Print the full market ranking as text, json or csv.")
+	normalize := flag.Bool("normalize", false,
+		"Count the markets by ISO 3166 country code instead of the country as written.")
+	aliases := flag.String("aliases", "",
+		"A CSV file of extra country aliases with the columns alias and code, used by -normalize.")
+	stream := flag.Bool("stream", false,
+		"Stream the users from file and count them in parallel, for very large exports.")
+	workers := flag.Int("workers", runtime.NumCPU(),
+		"The number of goroutines counting users when streaming.")
+	groupKeys := flag.String("group-by", "",
+		"Group the users by these comma separated field paths instead, e.g. country,plan.tier or signedUpAt:month.")
+	agg := flag.String("agg", "count",
+		"The aggregate for -group-by: count, distinct:field or sum:field.")
+	growth := flag.String("growth", "",
+		"Report the signups per country by week, month or quarter and which market grows fastest.")
+	approx := flag.Bool("approx", false,
+		"Estimate the markets and distinct users with fixed memory sketches while streaming.")
+	epsilon := flag.Float64("epsilon", 0.01,
+		"The largest error of -approx country counts, as a fraction of all users.")
+	delta := flag.Float64("delta", 0.01,
+		"The chance that an -approx country count is outside -epsilon.")
+	hllErr := flag.Float64("distinct-error", 0.02,
+		"The relative standard error of the -approx distinct users.")
+	input := flag.String("input", path,
+		"The users file read by -approx, or - to read a stream of users from stdin.")
+	reportEvery := flag.Duration("report-every", 10*time.Second,
+		"How often -approx reports on the users read so far, 0 for only at the end.")
+	publish := flag.Bool("publish", false,
+		"Prepare the market counts for sharing with partners by suppressing small cells.")
+	minCell := flag.Int("k", 5,
+		"The fewest users a published country may have, smaller ones are suppressed.")
+	privacy := flag.Float64("privacy-epsilon", 0,
+		"Add Laplace noise to the published counts with this privacy budget, 0 for none.")
+	seed := flag.Int64("seed", 0,
+		"The seed of the published noise, 0 for a random seed. Reuse the reported seed to reproduce a report.")
+	flag.Parse()
+	if *approx {
+		r := os.Stdin
+		if *input != "-" {
+			f, err := os.Open(*input)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			r = f
+		}
+		var reported uint64
+		m, err := sketchData(r, *epsilon, *delta, *hllErr, *reportEvery, func(m *marketSketch) {
+			// A quiet stream is not reported on again.
+			if m.cms.total == reported {
+				return
+			}
+			reported = m.cms.total
+			log.Printf("After %d users:\n", m.cms.total)
+			printSketch(m, *top)
+		})
+		if err != nil {
+			log.Fatalf("%s: %v", *input, err)
+		}
+		log.Printf("All %d users read:\n", m.cms.total)
+		printSketch(m, *top)
+		return
+	}
+	if *growth != "" {
+		periods, growths, skipped, err := growthByCountry(importData(), *growth)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if skipped > 0 {
+			log.Printf("Left out %d users without a signup time.\n", skipped)
+		}
+		if err := writeGrowth(os.Stdout, periods, growths); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *groupKeys != "" {
+		if err := printGroups(*groupKeys, *agg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	var counts map[string]int
+	if *stream {
+		var err error
+		if counts, err = streamData(*workers); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		counts = countMarkets(importData())
+	}
+	var n *normalizer
+	if *normalize {
+		var err error
+		if n, err = newNormalizer(); err != nil {
+			log.Fatal(err)
+		}
+		if *aliases != "" {
+			if err := n.loadAliases(*aliases); err != nil {
+				log.Fatal(err)
+			}
+		}
+		var unknown map[string]int
+		counts, unknown = n.normalizeCounts(counts)
+		if !*publish {
+			printUnknown(unknown)
+		}
+	}
+	if *publish {
+		if *privacy > 0 && *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		var suppressed int
+		counts, suppressed = publishCounts(counts, *minCell, *privacy, *seed)
+		log.Printf("Countries suppressed for having fewer than %d users: %d.\n", *minCell, suppressed)
+		if *privacy > 0 {
+			log.Printf("Added Laplace noise with epsilon %v and seed %d.\n", *privacy, *seed)
+		}
+	}
+	ranks := rankCounts(counts)
+	if n != nil {
+		for i := range ranks {
+			ranks[i].Name = n.name(ranks[i].Country)
 		}
 	}
 
-	return maxCountry, maxCount
+	if *top > 0 || *format != "" {
+		if *format == "" {
+			*format = "text"
+		}
+		if err := writeReport(os.Stdout, topMarkets(ranks, *top), *format); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(ranks) == 0 {
+		log.Println("No user markets found.")
+		return
+	}
+	log.Printf("The biggest user market is %s with %d users.\n",
+		ranks[0].label(), ranks[0].Count)
 }
 
-func main() {
-	users := importData()
-	country, count := getBiggestMarket(users)
-	log.Printf("The biggest user market is %s with %d users.\n",
-		country, count)
+// printGroups groups the users by the keys and prints the
+// aggregate of every group as a pivot table.
+func printGroups(keySpecs, aggSpec string) error {
+	keys, err := parseKeys(keySpecs)
+	if err != nil {
+		return err
+	}
+	agg, err := parseAggregate(aggSpec)
+	if err != nil {
+		return err
+	}
+	records, err := importRecords()
+	if err != nil {
+		return err
+	}
+	rows, err := groupBy(records, keys, agg)
+	if err != nil {
+		return err
+	}
+
+	return writePivot(os.Stdout, rows, keys, agg)
+}
+
+// printUnknown prints the countries that could not be normalized.
+func printUnknown(unknown map[string]int) {
+	if len(unknown) == 0 {
+		return
+	}
+	log.Printf("Countries not recognized (%d):\n", len(unknown))
+	for _, r := range rankCounts(unknown) {
+		log.Printf("  %q with %d users\n", r.Country, r.Count)
+	}
 }
 
 // importData reads the raffle entries from file and
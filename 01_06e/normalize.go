@@ -0,0 +1,150 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// isoTable is the ISO 3166-1 country table with the columns
+// alpha2, alpha3, name, official_name and common_name.
+//
+//go:embed iso3166.csv
+var isoTable string
+
+// defaultAliases maps other common country names to their
+// ISO 3166-1 alpha-2 code, with the columns alias and code.
+//
+//go:embed aliases.csv
+var defaultAliases string
+
+// normalizer maps free text country names to ISO 3166-1 alpha-2 codes.
+type normalizer struct {
+	codes map[string]string
+	names map[string]string
+}
+
+// newNormalizer returns a normalizer that knows every ISO 3166-1
+// code and name as well as the default aliases.
+func newNormalizer() (*normalizer, error) {
+	n := &normalizer{
+		codes: make(map[string]string),
+		names: make(map[string]string),
+	}
+	rows, err := readTable(strings.NewReader(isoTable), 5)
+	if err != nil {
+		return nil, fmt.Errorf("iso3166.csv: %v", err)
+	}
+	for _, row := range rows {
+		code := row[0]
+		n.names[code] = row[2]
+		for _, key := range row {
+			if key != "" {
+				n.codes[foldCountry(key)] = code
+			}
+		}
+	}
+	if err := n.addAliases(strings.NewReader(defaultAliases)); err != nil {
+		return nil, fmt.Errorf("aliases.csv: %v", err)
+	}
+
+	return n, nil
+}
+
+// addAliases reads extra aliases with the columns alias and code.
+// Aliases replace any earlier mapping of the same name.
+func (n *normalizer) addAliases(r io.Reader) error {
+	rows, err := readTable(r, 2)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		code := strings.ToUpper(strings.TrimSpace(row[1]))
+		if _, ok := n.names[code]; !ok {
+			return fmt.Errorf("row %d: %q is not an ISO 3166-1 alpha-2 code", i+2, row[1])
+		}
+		n.codes[foldCountry(row[0])] = code
+	}
+
+	return nil
+}
+
+// loadAliases reads extra aliases from the given file.
+func (n *normalizer) loadAliases(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := n.addAliases(f); err != nil {
+		return fmt.Errorf("%s: %v", p, err)
+	}
+	return nil
+}
+
+// normalize returns the alpha-2 code for the country, and
+// false if the country is not recognized.
+func (n *normalizer) normalize(country string) (string, bool) {
+	code, ok := n.codes[foldCountry(country)]
+	return code, ok
+}
+
+// name returns the ISO 3166-1 short name of the code.
+func (n *normalizer) name(code string) string {
+	return n.names[code]
+}
+
+// normalizeCounts re-keys the market counts on alpha-2 codes.
+// Countries that are not recognized are returned separately.
+func (n *normalizer) normalizeCounts(counts map[string]int) (map[string]int, map[string]int) {
+	canonical := make(map[string]int)
+	unknown := make(map[string]int)
+	for country, count := range counts {
+		if code, ok := n.normalize(country); ok {
+			canonical[code] += count
+		} else {
+			unknown[country] += count
+		}
+	}
+
+	return canonical, unknown
+}
+
+// foldCountry folds a country name so that case, punctuation
+// and spacing differences do not matter.
+func foldCountry(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-' || r == ',':
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// readTable reads a CSV table with a header row, checking
+// that every row has the given number of columns.
+func readTable(r io.Reader, columns int) ([][]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = columns
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("missing header row")
+	}
+	return rows[1:], nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// laplaceNoise draws from the Laplace distribution centred on
+// zero with the given scale.
+func laplaceNoise(rng *rand.Rand, scale float64) float64 {
+	u := rng.Float64() - 0.5
+	if u == -0.5 {
+		u = 0
+	}
+	return -scale * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+}
+
+// addNoise returns the counts with Laplace noise calibrated to the
+// privacy budget epsilon. Every user is in one country only, so a
+// single user changes one count by one and the noise scale is
+// 1/epsilon. Noisy counts are rounded and never below zero.
+// Countries are visited in name order so that the same seed always
+// gives the same report.
+func addNoise(counts map[string]int, epsilon float64, rng *rand.Rand) map[string]int {
+	countries := make([]string, 0, len(counts))
+	for country := range counts {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+
+	noisy := make(map[string]int, len(counts))
+	for _, country := range countries {
+		n := int(math.Round(float64(counts[country]) + laplaceNoise(rng, 1/epsilon)))
+		if n < 0 {
+			n = 0
+		}
+		noisy[country] = n
+	}
+
+	return noisy
+}
+
+// suppressSmall returns the counts without the countries that have
+// fewer than k users, and how many countries were suppressed.
+func suppressSmall(counts map[string]int, k int) (map[string]int, int) {
+	kept := make(map[string]int, len(counts))
+	suppressed := 0
+	for country, count := range counts {
+		if count < k {
+			suppressed++
+			continue
+		}
+		kept[country] = count
+	}
+
+	return kept, suppressed
+}
+
+// publishCounts prepares the counts for sharing. Noise is added
+// first when epsilon is above zero, so that small cells are
+// suppressed on the noisy counts rather than the exact ones.
+func publishCounts(counts map[string]int, k int, epsilon float64, seed int64) (map[string]int, int) {
+	if epsilon > 0 {
+		counts = addNoise(counts, epsilon, rand.New(rand.NewSource(seed)))
+	}
+	return suppressSmall(counts, k)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// marketRank is a country's place in the market ranking.
+type marketRank struct {
+	Rank       int     `json:"rank"`
+	Country    string  `json:"country"`
+	Name       string  `json:"name,omitempty"`
+	Count      int     `json:"count"`
+	Share      float64 `json:"share"`
+	Cumulative float64 `json:"cumulativeShare"`
+}
+
+// rankCounts ranks the markets from most to fewest users.
+// Ties are broken by country name, so the ranking is
+// the same on every run.
+func rankCounts(counts map[string]int) []marketRank {
+	total := 0
+	ranks := make([]marketRank, 0, len(counts))
+	for country, count := range counts {
+		ranks = append(ranks, marketRank{Country: country, Count: count})
+		total += count
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if ranks[i].Count != ranks[j].Count {
+			return ranks[i].Count > ranks[j].Count
+		}
+		return ranks[i].Country < ranks[j].Country
+	})
+
+	cumulative := 0
+	for i := range ranks {
+		cumulative += ranks[i].Count
+		ranks[i].Rank = i + 1
+		if total > 0 {
+			ranks[i].Share = float64(ranks[i].Count) / float64(total) * 100
+			ranks[i].Cumulative = float64(cumulative) / float64(total) * 100
+		}
+	}
+
+	return ranks
+}
+
+// label returns the country with its name when it has one.
+func (r marketRank) label() string {
+	if r.Name == "" {
+		return r.Country
+	}
+	return fmt.Sprintf("%s (%s)", r.Country, r.Name)
+}
+
+// topMarkets returns the first n ranks, or all of them when n is zero or less.
+func topMarkets(ranks []marketRank, n int) []marketRank {
+	if n <= 0 || n >= len(ranks) {
+		return ranks
+	}
+	return ranks[:n]
+}
+
+// writeReport writes the market ranking in the given format,
+// which is one of text, json or csv.
+func writeReport(w io.Writer, ranks []marketRank, format string) error {
+	switch format {
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "Rank\tCountry\tUsers\tShare\tCumulative\t")
+		for _, r := range ranks {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%.2f%%\t%.2f%%\t\n",
+				r.Rank, r.label(), r.Count, r.Share, r.Cumulative)
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ranks)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"rank", "country", "name", "count", "share", "cumulative_share"})
+		for _, r := range ranks {
+			cw.Write([]string{
+				strconv.Itoa(r.Rank),
+				r.Country,
+				r.Name,
+				strconv.Itoa(r.Count),
+				strconv.FormatFloat(r.Share, 'f', 2, 64),
+				strconv.FormatFloat(r.Cumulative, 'f', 2, 64),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown report format %q: want text, json or csv", format)
+}
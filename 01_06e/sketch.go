@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+	"unicode"
+)
+
+// hashKey hashes the key to 64 well mixed bits.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// The splitmix64 finalizer spreads fnv's output over every bit,
+	// which HyperLogLog needs to count leading zeros reliably.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// countMinSketch estimates how often each key was seen in fixed
+// memory. Estimates never undercount, and overcount by at most
+// epsilon times the number of keys seen with probability 1-delta.
+type countMinSketch struct {
+	width  uint64
+	counts [][]uint64
+	total  uint64
+}
+
+// newCountMinSketch returns a sketch sized for the error bounds.
+func newCountMinSketch(epsilon, delta float64) (*countMinSketch, error) {
+	if epsilon <= 0 || epsilon >= 1 || delta <= 0 || delta >= 1 {
+		return nil, fmt.Errorf("epsilon %v and delta %v must be between 0 and 1", epsilon, delta)
+	}
+	width := uint64(math.Ceil(math.E / epsilon))
+	depth := int(math.Ceil(math.Log(1 / delta)))
+	counts := make([][]uint64, depth)
+	for i := range counts {
+		counts[i] = make([]uint64, width)
+	}
+	return &countMinSketch{width: width, counts: counts}, nil
+}
+
+// add counts one more of the key.
+func (s *countMinSketch) add(key string) {
+	h := hashKey(key)
+	h1, h2 := h&math.MaxUint32, h>>32
+	for i, row := range s.counts {
+		row[(h1+uint64(i)*h2)%s.width]++
+	}
+	s.total++
+}
+
+// estimate returns how often the key was probably seen.
+func (s *countMinSketch) estimate(key string) uint64 {
+	h := hashKey(key)
+	h1, h2 := h&math.MaxUint32, h>>32
+	est := uint64(math.MaxUint64)
+	for i, row := range s.counts {
+		if c := row[(h1+uint64(i)*h2)%s.width]; c < est {
+			est = c
+		}
+	}
+	return est
+}
+
+// errorBound returns how much an estimate may overcount.
+func (s *countMinSketch) errorBound() uint64 {
+	return uint64(math.Ceil(math.E / float64(s.width) * float64(s.total)))
+}
+
+// spaceSaving tracks the most frequent keys with a fixed number of
+// counters. Any key seen more than total/capacity times is kept,
+// and its count is overestimated by at most its error.
+type spaceSaving struct {
+	capacity int
+	counts   map[string]*heavyHitter
+	total    uint64
+}
+
+// heavyHitter is a key tracked by the space-saving counters.
+type heavyHitter struct {
+	Key   string
+	Count uint64
+	Error uint64
+}
+
+// newSpaceSaving returns counters that keep every key more
+// frequent than epsilon times the number of keys seen.
+func newSpaceSaving(epsilon float64) (*spaceSaving, error) {
+	if epsilon <= 0 || epsilon >= 1 {
+		return nil, fmt.Errorf("epsilon %v must be between 0 and 1", epsilon)
+	}
+	capacity := int(math.Ceil(1 / epsilon))
+	return &spaceSaving{capacity: capacity, counts: make(map[string]*heavyHitter, capacity)}, nil
+}
+
+// add counts one more of the key, replacing the least frequent
+// key when every counter is in use.
+func (s *spaceSaving) add(key string) {
+	s.total++
+	if hh, ok := s.counts[key]; ok {
+		hh.Count++
+		return
+	}
+	if len(s.counts) < s.capacity {
+		s.counts[key] = &heavyHitter{Key: key, Count: 1}
+		return
+	}
+	var min *heavyHitter
+	for _, hh := range s.counts {
+		if min == nil || hh.Count < min.Count || (hh.Count == min.Count && hh.Key > min.Key) {
+			min = hh
+		}
+	}
+	delete(s.counts, min.Key)
+	s.counts[key] = &heavyHitter{Key: key, Count: min.Count + 1, Error: min.Count}
+}
+
+// top returns the tracked keys from most to least frequent,
+// breaking ties by key.
+func (s *spaceSaving) top() []heavyHitter {
+	hhs := make([]heavyHitter, 0, len(s.counts))
+	for _, hh := range s.counts {
+		hhs = append(hhs, *hh)
+	}
+	sort.Slice(hhs, func(i, j int) bool {
+		if hhs[i].Count != hhs[j].Count {
+			return hhs[i].Count > hhs[j].Count
+		}
+		return hhs[i].Key < hhs[j].Key
+	})
+	return hhs
+}
+
+// hyperLogLog estimates the number of distinct keys in fixed memory.
+type hyperLogLog struct {
+	p         uint8
+	registers []uint8
+}
+
+// newHyperLogLog returns a counter whose relative standard error
+// is at most the given error.
+func newHyperLogLog(relErr float64) (*hyperLogLog, error) {
+	if relErr <= 0 || relErr >= 1 {
+		return nil, fmt.Errorf("relative error %v must be between 0 and 1", relErr)
+	}
+	p := uint8(math.Ceil(math.Log2(math.Pow(1.04/relErr, 2))))
+	if p < 4 {
+		p = 4
+	}
+	if p > 18 {
+		p = 18
+	}
+	return &hyperLogLog{p: p, registers: make([]uint8, 1<<p)}, nil
+}
+
+// add records the key.
+func (h *hyperLogLog) add(key string) {
+	x := hashKey(key)
+	idx := x >> (64 - h.p)
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// estimate returns the probable number of distinct keys,
+// using linear counting while few registers are set.
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(est))
+}
+
+// stdError returns the relative standard error of the estimate.
+func (h *hyperLogLog) stdError() float64 {
+	return 1.04 / math.Sqrt(float64(len(h.registers)))
+}
+
+// marketSketch summarizes a stream of users in bounded memory.
+type marketSketch struct {
+	cms      *countMinSketch
+	ss       *spaceSaving
+	distinct *hyperLogLog
+}
+
+// newMarketSketch returns sketches sized for the error bounds:
+// epsilon and delta for the country counts and relErr for
+// the distinct users.
+func newMarketSketch(epsilon, delta, relErr float64) (*marketSketch, error) {
+	cms, err := newCountMinSketch(epsilon, delta)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := newSpaceSaving(epsilon)
+	if err != nil {
+		return nil, err
+	}
+	hll, err := newHyperLogLog(relErr)
+	if err != nil {
+		return nil, err
+	}
+	return &marketSketch{cms: cms, ss: ss, distinct: hll}, nil
+}
+
+// add records the user. Users without an ID are told apart by name.
+func (m *marketSketch) add(u User) {
+	m.cms.add(u.Country)
+	m.ss.add(u.Country)
+	id := u.ID
+	if id == "" {
+		id = "name:" + u.Name
+	}
+	m.distinct.add(id)
+}
+
+// approxMarket is the estimated size of a heavy hitter market.
+type approxMarket struct {
+	Country string
+	Count   uint64
+	Bound   uint64
+}
+
+// heavyHitters returns the estimated biggest markets. Each count is
+// the lower of the space-saving and count-min estimates, and the
+// bound is how far it may overcount.
+func (m *marketSketch) heavyHitters() []approxMarket {
+	var markets []approxMarket
+	for _, hh := range m.ss.top() {
+		am := approxMarket{Country: hh.Key, Count: hh.Count, Bound: hh.Error}
+		if est := m.cms.estimate(hh.Key); est < am.Count {
+			am.Count, am.Bound = est, m.cms.errorBound()
+		}
+		markets = append(markets, am)
+	}
+	sort.SliceStable(markets, func(i, j int) bool {
+		if markets[i].Count != markets[j].Count {
+			return markets[i].Count > markets[j].Count
+		}
+		return markets[i].Country < markets[j].Country
+	})
+	return markets
+}
+
+// sketchData streams the users from r into a market sketch. The
+// users are either a JSON array or a stream of JSON objects, such as
+// one event per line, and the stream may go on for as long as r does.
+// When every is above zero, report is called with the sketch at that
+// interval while the stream is read, so that a stream that never ends
+// is still reported on.
+func sketchData(r io.Reader, epsilon, delta, relErr float64,
+	every time.Duration, report func(*marketSketch)) (*marketSketch, error) {
+	m, err := newMarketSketch(epsilon, delta, relErr)
+	if err != nil {
+		return nil, err
+	}
+
+	batches := make(chan []User, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var tick <-chan time.Time
+		if every > 0 && report != nil {
+			ticker := time.NewTicker(every)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case batch, ok := <-batches:
+				if !ok {
+					return
+				}
+				for _, u := range batch {
+					m.add(u)
+				}
+			case <-tick:
+				report(m)
+			}
+		}
+	}()
+	err = streamEvents(r, batches)
+	close(batches)
+	<-done
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// streamEvents sends the users from r on out in batches. An array
+// is handed to streamUsers, and anything else is read as a stream
+// of user objects.
+func streamEvents(r io.Reader, out chan<- []User) error {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !unicode.IsSpace(rune(b[0])) {
+			if b[0] == '[' {
+				return streamUsers(br, out)
+			}
+			break
+		}
+		br.ReadByte()
+	}
+
+	dec := json.NewDecoder(br)
+	batch := make([]User, 0, batchSize)
+	for {
+		var u User
+		err := dec.Decode(&u)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		batch = append(batch, u)
+		// A live stream may pause for a long time, so the batch is
+		// sent once every event read so far has been decoded.
+		if len(batch) == batchSize || !moreBuffered(dec) {
+			out <- batch
+			batch = make([]User, 0, batchSize)
+		}
+	}
+	if len(batch) > 0 {
+		out <- batch
+	}
+
+	return nil
+}
+
+// moreBuffered returns whether the decoder holds more than white
+// space that it has read but not decoded yet.
+func moreBuffered(dec *json.Decoder) bool {
+	rest, _ := io.ReadAll(dec.Buffered())
+	return len(bytes.TrimSpace(rest)) > 0
+}
+
+// printSketch prints the estimated top markets and distinct users.
+func printSketch(m *marketSketch, top int) {
+	markets := m.heavyHitters()
+	if len(markets) == 0 {
+		log.Println("No user markets found.")
+		return
+	}
+	log.Printf("The biggest user market is probably %s with about %d users (at most %d too many).\n",
+		markets[0].Country, markets[0].Count, markets[0].Bound)
+	if top > 1 {
+		for i, am := range markets {
+			if i == top {
+				break
+			}
+			log.Printf("[%d]: %s ~%d (+%d)\n", i+1, am.Country, am.Count, am.Bound)
+		}
+	}
+	log.Printf("There are about %d distinct users (±%.1f%%).\n",
+		m.distinct.estimate(), m.distinct.stdError()*100)
+}
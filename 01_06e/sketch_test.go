@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// skewedUsers returns users whose countries follow a long tail:
+// one big market, a few mid-sized ones and many small ones.
+// Some users appear twice, as they would in an event stream.
+func skewedUsers() []User {
+	var users []User
+	add := func(country string, n int) {
+		for i := 0; i < n; i++ {
+			id := fmt.Sprintf("u%d", len(users))
+			users = append(users, User{ID: id, Name: "User " + id, Country: country})
+		}
+	}
+	add("Germany", 20000)
+	for i := 0; i < 10; i++ {
+		add(fmt.Sprintf("Mid %d", i), 2000-i*100)
+	}
+	for i := 0; i < 500; i++ {
+		add(fmt.Sprintf("Small %d", i), 1+i%20)
+	}
+	for i := 0; i < 5000; i += 5 {
+		users = append(users, users[i])
+	}
+	return users
+}
+
+func TestSketchMatchesExactCounts(t *testing.T) {
+	users := skewedUsers()
+	var stream bytes.Buffer
+	enc := json.NewEncoder(&stream)
+	for _, u := range users {
+		if err := enc.Encode(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := sketchData(&stream, 0.001, 0.01, 0.02, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	country, count := getBiggestMarket(users)
+	markets := m.heavyHitters()
+	if len(markets) == 0 {
+		t.Fatal("no heavy hitters found")
+	}
+	if markets[0].Country != country {
+		t.Errorf("biggest market = %s, want %s with %d users", markets[0].Country, country, count)
+	}
+
+	exact := countMarkets(users)
+	bound := m.cms.errorBound()
+	for c, n := range exact {
+		est := m.cms.estimate(c)
+		if est < uint64(n) || est > uint64(n)+bound {
+			t.Errorf("count-min estimate of %s = %d, want %d to %d", c, est, n, uint64(n)+bound)
+		}
+	}
+	for _, am := range markets {
+		n := uint64(exact[am.Country])
+		if am.Count < n || am.Count > n+am.Bound {
+			t.Errorf("heavy hitter %s = %d (+%d), counted %d", am.Country, am.Count, am.Bound, n)
+		}
+	}
+
+	ids := make(map[string]bool)
+	for _, u := range users {
+		ids[u.ID] = true
+	}
+	est, want := float64(m.distinct.estimate()), float64(len(ids))
+	if relErr := math.Abs(est-want) / want; relErr > 3*m.distinct.stdError() {
+		t.Errorf("distinct users = %.0f, want %.0f within %.1f%%", est, want, 3*m.distinct.stdError()*100)
+	}
+}
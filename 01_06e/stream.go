@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// batchSize is the number of users decoded before a batch
+// is handed to a counting worker.
+const batchSize = 1024
+
+// streamUsers decodes the JSON array of users from r one user at a
+// time, sending them on out in batches. Only a few batches are held
+// in memory at once, however large the array is.
+func streamUsers(r io.Reader, out chan<- []User) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected an array of users, found %v", tok)
+	}
+
+	batch := make([]User, 0, batchSize)
+	for dec.More() {
+		var u User
+		if err := dec.Decode(&u); err != nil {
+			return err
+		}
+		batch = append(batch, u)
+		if len(batch) == batchSize {
+			out <- batch
+			batch = make([]User, 0, batchSize)
+		}
+	}
+	if len(batch) > 0 {
+		out <- batch
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// countMarketsStream counts the users in each country while
+// streaming them from r. Each of the workers counts into its own
+// map, and the maps are merged once all users have been read.
+func countMarketsStream(r io.Reader, workers int) (map[string]int, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	batches := make(chan []User, workers)
+	shards := make([]map[string]int, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		shards[i] = make(map[string]int)
+		wg.Add(1)
+		go func(counts map[string]int) {
+			defer wg.Done()
+			for batch := range batches {
+				for _, u := range batch {
+					counts[u.Country]++
+				}
+			}
+		}(shards[i])
+	}
+
+	err := streamUsers(r, batches)
+	close(batches)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, shard := range shards {
+		for country, count := range shard {
+			counts[country] += count
+		}
+	}
+
+	return counts, nil
+}
+
+// streamData counts the users in each country straight from file.
+func streamData(workers int) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	counts, err := countMarketsStream(f, workers)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return counts, nil
+}
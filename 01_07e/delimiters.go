@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// delimiter is one side of a delimiter pair.
+type delimiter struct {
+	text string
+	// close is the closer of the pair when the delimiter opens one.
+	close  string
+	opener bool
+	closer bool
+}
+
+// delimiterSet is the delimiter pairs to check, optionally
+// with HTML or XML tags matched by name.
+type delimiterSet struct {
+	// delims are sorted from longest to shortest, so the first
+	// one that matches is the longest match.
+	delims []delimiter
+	maxLen int
+	// tags is "html", "xml", or empty to not match tags.
+	tags string
+}
+
+// token is a delimiter found in the source. A delimiter that is
+// its own closer, like |, is an opener whose close is its text.
+type token struct {
+	kind operatorType
+	text string
+	// close is the closer expected for an opener.
+	close string
+	pos   position
+	// end is the byte offset just after the delimiter.
+	end int
+}
+
+// voidElements are the HTML elements that never have a closing tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// parsePairs parses a list of delimiter pairs separated by spaces or
+// commas. A pair is either two runes, such as (), or an opener and
+// closer separated by a colon, such as begin:end or <!--:-->.
+func parsePairs(spec, tags string) (*delimiterSet, error) {
+	if tags != "" && tags != "html" && tags != "xml" {
+		return nil, fmt.Errorf("unknown tags %q: want html or xml", tags)
+	}
+	ds := &delimiterSet{tags: tags}
+	seen := make(map[string]delimiter)
+	add := func(d delimiter) error {
+		if prev, ok := seen[d.text]; ok {
+			return fmt.Errorf("delimiter %q is used by more than one pair (%q and %q)",
+				d.text, prev.text+" "+prev.close, d.text+" "+d.close)
+		}
+		seen[d.text] = d
+		ds.delims = append(ds.delims, d)
+		return nil
+	}
+	fields := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, f := range fields {
+		open, close, err := splitPair(f)
+		if err != nil {
+			return nil, err
+		}
+		if open == close {
+			// A delimiter like | closes the pair if it is open
+			// and opens it otherwise.
+			if err := add(delimiter{text: open, close: close, opener: true, closer: true}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := add(delimiter{text: open, close: close, opener: true}); err != nil {
+			return nil, err
+		}
+		if err := add(delimiter{text: close, closer: true}); err != nil {
+			return nil, err
+		}
+	}
+	if len(ds.delims) == 0 && tags == "" {
+		return nil, fmt.Errorf("no delimiter pairs in %q", spec)
+	}
+
+	sort.SliceStable(ds.delims, func(i, j int) bool {
+		return len(ds.delims[i].text) > len(ds.delims[j].text)
+	})
+	for _, d := range ds.delims {
+		if len(d.text) > ds.maxLen {
+			ds.maxLen = len(d.text)
+		}
+	}
+	return ds, nil
+}
+
+// splitPair splits a pair into its opener and closer.
+func splitPair(f string) (string, string, error) {
+	if utf8.RuneCountInString(f) == 2 {
+		r, size := utf8.DecodeRuneInString(f)
+		return string(r), f[size:], nil
+	}
+	// The opener is never empty, so a colon at the start is part of it.
+	if i := strings.Index(f[1:], ":"); i >= 0 {
+		open, close := f[:i+1], f[i+2:]
+		if close != "" {
+			return open, close, nil
+		}
+	}
+	return "", "", fmt.Errorf("bad delimiter pair %q: want two runes or opener:closer", f)
+}
+
+// isWordRune returns whether the rune can be part of a word.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// bounded returns whether the delimiter at the start of b stands on
+// its own. A delimiter that starts or ends with a word rune, such as
+// begin or #endif, must not run into a word around it.
+func bounded(prev rune, b []byte, text string) bool {
+	first, _ := utf8.DecodeRuneInString(text)
+	if isWordRune(first) && isWordRune(prev) {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(text)
+	if isWordRune(last) && len(b) > len(text) {
+		if next, _ := utf8.DecodeRune(b[len(text):]); isWordRune(next) {
+			return false
+		}
+	}
+	return true
+}
+
+// next consumes the delimiter or tag at the start of the scanner, if
+// there is one. Tags that neither open nor close anything, such as
+// void elements or comments, are consumed with kind otherOperator.
+func (ds *delimiterSet) next(s *scanner) (token, bool) {
+	pos := s.pos
+	b := s.peek(ds.maxLen + utf8.UTFMax)
+	for _, d := range ds.delims {
+		if !bytes.HasPrefix(b, []byte(d.text)) || !bounded(s.prev, b, d.text) {
+			continue
+		}
+		s.skip(len(d.text))
+		tok := token{kind: closedBracket, text: d.text, pos: pos}
+		if d.opener {
+			tok.kind, tok.close = openBracket, d.close
+		}
+		return tok, true
+	}
+	if ds.tags != "" && s.hasPrefix("<") {
+		return ds.nextTag(s)
+	}
+	return token{}, false
+}
+
+// nextTag consumes the tag at the start of the scanner.
+func (ds *delimiterSet) nextTag(s *scanner) (token, bool) {
+	pos := s.pos
+	b := s.peek(4)
+	switch {
+	case bytes.HasPrefix(b, []byte("<!--")):
+		s.skipPast("-->")
+		return token{kind: otherOperator, pos: pos}, true
+	case len(b) >= 2 && (b[1] == '!' || b[1] == '?'):
+		// Declarations and processing instructions.
+		s.skipPast(">")
+		return token{kind: otherOperator, pos: pos}, true
+	}
+	closing := len(b) >= 2 && b[1] == '/'
+	start := 1
+	if closing {
+		start = 2
+	}
+	b = s.peek(start + utf8.UTFMax)
+	if len(b) <= start {
+		return token{}, false
+	}
+	if r, _ := utf8.DecodeRune(b[start:]); !isNameStart(r) {
+		return token{}, false
+	}
+	s.skip(start)
+
+	var name strings.Builder
+	for {
+		nb := s.peek(utf8.UTFMax)
+		r, _ := utf8.DecodeRune(nb)
+		if len(nb) == 0 || !isNameRune(r) {
+			break
+		}
+		s.next()
+		name.WriteRune(r)
+	}
+	selfClosing := skipTag(s)
+
+	n := name.String()
+	if ds.tags == "html" {
+		n = strings.ToLower(n)
+	}
+	switch {
+	case closing:
+		return token{kind: closedBracket, text: "</" + n + ">", pos: pos}, true
+	case selfClosing || (ds.tags == "html" && voidElements[n]):
+		return token{kind: otherOperator, text: "<" + n + ">", pos: pos}, true
+	}
+	return token{kind: openBracket, text: "<" + n + ">", close: "</" + n + ">", pos: pos}, true
+}
+
+// skipTag consumes the rest of a tag up to and including the >,
+// skipping quoted attribute values, and reports whether it ends
+// with />.
+func skipTag(s *scanner) bool {
+	var quote rune
+	slash := false
+	for {
+		r, ok := s.next()
+		if !ok {
+			return false
+		}
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '>':
+			return slash
+		}
+		if !unicode.IsSpace(r) {
+			slash = r == '/'
+		}
+	}
+}
+
+// isNameStart returns whether a tag name can start with the rune.
+func isNameStart(r rune) bool {
+	return r == '_' || r == ':' || unicode.IsLetter(r)
+}
+
+// isNameRune returns whether the rune can be part of a tag name.
+func isNameRune(r rune) bool {
+	return isNameStart(r) || unicode.IsDigit(r) || r == '-' || r == '.'
+}
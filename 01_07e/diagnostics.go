@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// position is a location in the checked source.
+type position struct {
+	// Offset is the 0-based byte offset from the start of the source.
+	Offset int `json:"offset"`
+	// Line and Column are 1-based, and columns count runes.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// String returns the position as line:column.
+func (p position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// errorKind is the kind of bracket error found.
+type errorKind int
+
+const (
+	noError errorKind = iota
+	unexpectedCloser
+	wrongCloser
+	unclosedOpener
+)
+
+// String returns the name of the error kind.
+func (k errorKind) String() string {
+	switch k {
+	case unexpectedCloser:
+		return "unexpected closer"
+	case wrongCloser:
+		return "wrong closer"
+	case unclosedOpener:
+		return "unclosed opener"
+	}
+	return "balanced"
+}
+
+// result is the outcome of checking an expression. When it is not
+// balanced, it describes the first error found.
+type result struct {
+	Balanced bool
+	Kind     errorKind
+	// Pos is where the error is: the unexpected or wrong closer,
+	// or the end of the source for an unclosed opener.
+	Pos      position
+	Found    string
+	Expected string
+	// Opener is the opener that the error concerns, if any.
+	Opener    string
+	OpenerPos position
+}
+
+// message describes the error in the style of a compiler.
+func (r result) message() string {
+	switch r.Kind {
+	case unexpectedCloser:
+		return fmt.Sprintf("unexpected closer: found %q with nothing open", r.Found)
+	case wrongCloser:
+		return fmt.Sprintf("wrong closer: expected %q, found %q", r.Expected, r.Found)
+	case unclosedOpener:
+		return fmt.Sprintf("unclosed opener: %q opened at %s is never closed, expected %q",
+			r.Opener, r.OpenerPos, r.Expected)
+	}
+	return "balanced"
+}
+
+// opened is a bracket waiting on the stack for its closer.
+type opened struct {
+	text  string
+	close string
+	pos   position
+}
+
+// checkBalance checks the brackets of the expression and
+// describes the first error it finds.
+func checkBalance(expr string) result {
+	res, _ := checkReader(strings.NewReader(expr), plainLexer{}, defaultDelimiters)
+	return res
+}
+
+// checkReader checks the delimiters of the source, skipping whatever
+// the lexer says is not code, and describes the first error it finds.
+// The source is read as it is checked, so it may be of any size.
+func checkReader(r io.Reader, lx lexer, ds *delimiterSet) (result, error) {
+	s := newScanner(r)
+	var open []opened
+	for !s.eof() {
+		if lx.skip(s) {
+			continue
+		}
+		tok, ok := ds.next(s)
+		if !ok {
+			s.next()
+			continue
+		}
+		if tok.kind == openBracket && tok.close == tok.text &&
+			len(open) > 0 && open[len(open)-1].close == tok.text {
+			tok.kind = closedBracket
+		}
+		switch tok.kind {
+		case openBracket:
+			open = append(open, opened{text: tok.text, close: tok.close, pos: tok.pos})
+		case closedBracket:
+			if len(open) == 0 {
+				return result{Kind: unexpectedCloser, Pos: tok.pos, Found: tok.text}, s.err
+			}
+			last := open[len(open)-1]
+			open = open[:len(open)-1]
+			if last.close != tok.text {
+				return result{Kind: wrongCloser, Pos: tok.pos, Found: tok.text,
+					Expected: last.close, Opener: last.text, OpenerPos: last.pos}, s.err
+			}
+		}
+	}
+	if s.err != nil {
+		return result{}, s.err
+	}
+	if len(open) > 0 {
+		last := open[len(open)-1]
+		return result{Kind: unclosedOpener, Pos: s.pos, Expected: last.close,
+			Opener: last.text, OpenerPos: last.pos}, nil
+	}
+
+	return result{Balanced: true}, nil
+}
+
+// advance returns the position after the rune.
+func advance(p position, r rune) position {
+	p.Offset += utf8.RuneLen(r)
+	if r == '\n' {
+		p.Line++
+		p.Column = 1
+	} else {
+		p.Column++
+	}
+	return p
+}
+
+// sourceLine returns the text of the given 1-based line.
+func sourceLine(src string, line int) string {
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[line-1], "\r")
+}
+
+// caret returns the line of text with a caret under the column,
+// keeping tabs so the caret lines up however tabs are shown.
+func caret(text string, column, width int) string {
+	var b strings.Builder
+	b.WriteString(text)
+	b.WriteByte('\n')
+	i := 1
+	for _, r := range text {
+		if i >= column {
+			break
+		}
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+		i++
+	}
+	for ; i < column; i++ {
+		b.WriteByte(' ')
+	}
+	if width < 1 {
+		width = 1
+	}
+	b.WriteString("^" + strings.Repeat("~", width-1))
+	return b.String()
+}
+
+// diagnostic formats the result like a compiler error, with the
+// source line and a caret under the error. Errors involving an
+// opener also show where it was opened.
+func diagnostic(name, src string, r result) string {
+	if r.Balanced {
+		return fmt.Sprintf("%s is balanced.", name)
+	}
+	at, width := r.Pos, utf8.RuneCountInString(r.Found)
+	if r.Kind == unclosedOpener {
+		at, width = r.OpenerPos, utf8.RuneCountInString(r.Opener)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:%s: %s\n", name, at, r.message())
+	b.WriteString(indent(caret(sourceLine(src, at.Line), at.Column, width)))
+	if r.Kind == wrongCloser {
+		fmt.Fprintf(&b, "\n%s:%s: note: %q opened here\n", name, r.OpenerPos, r.Opener)
+		b.WriteString(indent(caret(sourceLine(src, r.OpenerPos.Line),
+			r.OpenerPos.Column, utf8.RuneCountInString(r.Opener))))
+	}
+	return b.String()
+}
+
+// indent indents every line of the text.
+func indent(text string) string {
+	return "    " + strings.ReplaceAll(text, "\n", "\n    ")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// lexer knows which parts of a language are not code.
+type lexer interface {
+	// skip consumes the string, rune or comment that starts at the
+	// scanner, if any, and reports whether it consumed anything.
+	skip(s *scanner) bool
+}
+
+// plainLexer treats the whole source as code.
+type plainLexer struct{}
+
+// skip never skips anything.
+func (plainLexer) skip(*scanner) bool { return false }
+
+// cLexer skips the comments and literals of languages
+// with C-like syntax.
+type cLexer struct {
+	// comments is whether // and /* */ comments are allowed.
+	comments bool
+	// quotes are the quotes of literals with backslash escapes,
+	// which end at the end of the line if they are not closed.
+	quotes string
+	// multiline are the quotes of literals with backslash escapes
+	// that may span lines.
+	multiline string
+	// raw are the quotes of literals without escapes.
+	raw string
+}
+
+// skip consumes a comment or literal.
+func (l cLexer) skip(s *scanner) bool {
+	if l.comments {
+		if s.hasPrefix("//") {
+			for !s.eof() && !s.hasPrefix("\n") {
+				s.next()
+			}
+			return true
+		}
+		if s.hasPrefix("/*") {
+			s.skip(2)
+			s.skipPast("*/")
+			return true
+		}
+	}
+	b := s.peek(1)
+	if len(b) == 0 {
+		return false
+	}
+	q := rune(b[0])
+	switch {
+	case strings.ContainsRune(l.raw, q):
+		s.next()
+		s.skipPast(string(q))
+	case strings.ContainsRune(l.quotes, q):
+		s.next()
+		skipQuoted(s, q, false)
+	case strings.ContainsRune(l.multiline, q):
+		s.next()
+		skipQuoted(s, q, true)
+	default:
+		return false
+	}
+	return true
+}
+
+// skipQuoted consumes a literal with backslash escapes up to and
+// including the closing quote. Unless multiline is set, the literal
+// also ends before a newline so that an unclosed quote does not
+// hide the rest of the source.
+func skipQuoted(s *scanner, quote rune, multiline bool) {
+	for !s.eof() {
+		if !multiline && s.hasPrefix("\n") {
+			return
+		}
+		r, _ := s.next()
+		switch r {
+		case '\\':
+			if !multiline && s.hasPrefix("\n") {
+				return
+			}
+			s.next()
+		case quote:
+			return
+		}
+	}
+}
+
+// lexers are the lexers by language name.
+var lexers = map[string]lexer{
+	"plain": plainLexer{},
+	"go":    cLexer{comments: true, quotes: `"'`, raw: "`"},
+	"json":  cLexer{quotes: `"`},
+	"c":     cLexer{comments: true, quotes: `"'`},
+	"js":    cLexer{comments: true, quotes: `"'`, multiline: "`"},
+}
+
+// extLanguages maps file extensions to language names.
+var extLanguages = map[string]string{
+	".go":   "go",
+	".json": "json",
+	".c":    "c",
+	".h":    "c",
+	".cc":   "c",
+	".cpp":  "c",
+	".hpp":  "c",
+	".cs":   "c",
+	".java": "c",
+	".js":   "js",
+	".ts":   "js",
+}
+
+// languageOf returns the language of the file from its extension,
+// or plain if the extension is not known.
+func languageOf(name string) string {
+	if lang, ok := extLanguages[strings.ToLower(filepath.Ext(name))]; ok {
+		return lang
+	}
+	return "plain"
+}
+
+// lookupLexer returns the lexer for the language. An empty language
+// is detected from the file name.
+func lookupLexer(lang, name string) (lexer, error) {
+	if lang == "" {
+		lang = languageOf(name)
+	}
+	if lx, ok := lexers[strings.ToLower(lang)]; ok {
+		return lx, nil
+	}
+	names := make([]string, 0, len(lexers))
+	for name := range lexers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown language %q: want one of %s", lang, strings.Join(names, ", "))
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// fileResult is the outcome of checking one file.
+type fileResult struct {
+	Path   string
+	Result result
+	Err    error
+}
+
+// failed returns whether the file could not be read or is not balanced.
+func (fr fileResult) failed() bool {
+	return fr.Err != nil || !fr.Result.Balanced
+}
+
+// lintFiles returns the files to check under the paths. Files named
+// directly are always checked. Directories are walked for the files
+// of known languages, or for every file when lang is set, leaving out
+// hidden files and directories.
+func lintFiles(paths []string, lang string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if p == root || lang != "" || languageOf(p) != "plain" {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// lint checks the files with a pool of workers. Each file is streamed
+// from disk as it is checked, so only the workers' buffers are held in
+// memory at once. The results are in the order of the files.
+func lint(files []string, lang string, ds *delimiterSet, workers int) []fileResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]fileResult, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				res, err := checkFile(files[j], lang, ds)
+				results[j] = fileResult{Path: files[j], Result: res, Err: err}
+			}
+		}()
+	}
+	for j := range files {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// writeLint writes the results in the given format, which is one of
+// text, json or sarif. Text shows a diagnostic for every failure.
+func writeLint(w io.Writer, results []fileResult, format string) error {
+	switch format {
+	case "text":
+		failed := 0
+		for _, fr := range results {
+			if !fr.failed() {
+				continue
+			}
+			failed++
+			if fr.Err != nil {
+				fmt.Fprintf(w, "%v\n", fr.Err)
+				continue
+			}
+			src, err := os.ReadFile(fr.Path)
+			if err != nil {
+				fmt.Fprintf(w, "%v\n", err)
+				continue
+			}
+			fmt.Fprintln(w, diagnostic(fr.Path, string(src), fr.Result))
+		}
+		_, err := fmt.Fprintf(w, "Checked %d files: %d not balanced.\n", len(results), failed)
+		return err
+	case "json":
+		out := make([]jsonResult, len(results))
+		for i, fr := range results {
+			out[i] = newJSONResult(fr)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "sarif":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newSarifLog(results))
+	}
+	return fmt.Errorf("unknown lint format %q: want text, json or sarif", format)
+}
+
+// jsonResult is a file result as written in JSON.
+type jsonResult struct {
+	Path      string    `json:"path"`
+	Balanced  bool      `json:"balanced"`
+	Error     string    `json:"error,omitempty"`
+	Kind      string    `json:"kind,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Pos       *position `json:"position,omitempty"`
+	Found     string    `json:"found,omitempty"`
+	Expected  string    `json:"expected,omitempty"`
+	Opener    string    `json:"opener,omitempty"`
+	OpenerPos *position `json:"openerPosition,omitempty"`
+}
+
+// newJSONResult returns the file result as written in JSON.
+func newJSONResult(fr fileResult) jsonResult {
+	jr := jsonResult{Path: fr.Path, Balanced: fr.Result.Balanced}
+	switch {
+	case fr.Err != nil:
+		jr.Balanced, jr.Error = false, fr.Err.Error()
+	case !fr.Result.Balanced:
+		r := fr.Result
+		jr.Kind, jr.Message = r.Kind.String(), r.message()
+		jr.Pos, jr.Found, jr.Expected = &r.Pos, r.Found, r.Expected
+		if r.Opener != "" {
+			jr.Opener, jr.OpenerPos = r.Opener, &r.OpenerPos
+		}
+	}
+	return jr
+}
+
+// The types below are the parts of SARIF 2.1.0 that the linter
+// writes, so that CI systems can annotate the failing lines.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               int                   `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// ruleID returns the SARIF rule of the error kind, such as wrong-closer.
+func ruleID(k errorKind) string {
+	return strings.ReplaceAll(k.String(), " ", "-")
+}
+
+// newSarifLocation returns the location of the text at the position.
+func newSarifLocation(path string, pos position, text string) sarifLocation {
+	return sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifact{URI: filepath.ToSlash(path)},
+		Region: &sarifRegion{
+			StartLine:   pos.Line,
+			StartColumn: pos.Column,
+			EndColumn:   pos.Column + utf8.RuneCountInString(text),
+		},
+	}}
+}
+
+// newSarifLog returns a SARIF log with a result for every failure.
+// Columns count runes, as in the diagnostics.
+func newSarifLog(results []fileResult) sarifLog {
+	var rules []sarifRule
+	for _, k := range []errorKind{unexpectedCloser, wrongCloser, unclosedOpener} {
+		rules = append(rules, sarifRule{ID: ruleID(k), ShortDescription: sarifMessage{Text: k.String()}})
+	}
+	rules = append(rules, sarifRule{ID: "read-error", ShortDescription: sarifMessage{Text: "file could not be checked"}})
+
+	sarifResults := []sarifResult{}
+	for _, fr := range results {
+		if !fr.failed() {
+			continue
+		}
+		if fr.Err != nil {
+			sarifResults = append(sarifResults, sarifResult{
+				RuleID:  "read-error",
+				Level:   "error",
+				Message: sarifMessage{Text: fr.Err.Error()},
+				Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifact{URI: filepath.ToSlash(fr.Path)},
+				}}},
+			})
+			continue
+		}
+		r := fr.Result
+		at, text := r.Pos, r.Found
+		if r.Kind == unclosedOpener {
+			at, text = r.OpenerPos, r.Opener
+		}
+		sr := sarifResult{
+			RuleID:    ruleID(r.Kind),
+			Level:     "error",
+			Message:   sarifMessage{Text: r.message()},
+			Locations: []sarifLocation{newSarifLocation(fr.Path, at, text)},
+		}
+		if r.Kind == wrongCloser {
+			opener := newSarifLocation(fr.Path, r.OpenerPos, r.Opener)
+			opener.ID = 1
+			opener.Message = &sarifMessage{Text: fmt.Sprintf("%q opened here", r.Opener)}
+			sr.RelatedLocations = []sarifLocation{opener}
+		}
+		sarifResults = append(sarifResults, sr)
+	}
+
+	return sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool:       sarifTool{Driver: sarifDriver{Name: "brackets", Rules: rules}},
+			ColumnKind: "unicodeCodePoints",
+			Results:    sarifResults,
+		}},
+	}
+}
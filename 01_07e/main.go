@@ -2,7 +2,11 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"runtime"
+	"strings"
 )
 
 // operatorType represents the type of operator in an expression
@@ -14,78 +18,154 @@ const (
 	otherOperator
 )
 
-// bracketPairs is the map legal bracket pairs
-var bracketPairs = map[rune]rune{
-	'(': ')',
-	'[': ']',
-	'{': '}',
-}
-
-// getOperatorType return the operator type of the give operator.
-func getOperatorType(op rune) operatorType {
-	for ob, cb := range bracketPairs {
-		switch op {
-		case ob:
-			return openBracket
-		case cb:
-			return closedBracket
-		}
-	}
+// bracketPairs are the delimiter pairs checked by default.
+const bracketPairs = "() [] {}"
 
-	return otherOperator
-}
+// defaultDelimiters is the set of bracketPairs.
+var defaultDelimiters, _ = parsePairs(bracketPairs, "")
 
-// stack is a simple LIFO stack implementation using a slice.
-type stack struct {
-	elems []rune
+// isBalanced returns whether the given expression
+// has balanced brackets.
+func isBalanced(expr string) bool {
+	return checkBalance(expr).Balanced
 }
 
-// push adds a new element to the stack.
-func (s *stack) push(e rune) {
-	s.elems = append(s.elems, e)
+// printResult prints whether the expression is balanced,
+// and where the first error is if it is not.
+func printResult(expr string, res result) {
+	if res.Balanced {
+		log.Printf("%s is balanced.\n", expr)
+		return
+	}
+	log.Printf("%s is not balanced.\n", expr)
+	fmt.Fprintln(os.Stderr, diagnostic("expr", expr, res))
 }
 
-// pop removes the last element from the stack.
-func (s *stack) pop() *rune {
-	if len(s.elems) == 0 {
-		return nil
-	}
-	n := len(s.elems) - 1
-	last := s.elems[n]
-	s.elems = s.elems[:n]
-	return &last
+// checkFile checks the brackets of the file in the given language,
+// which is detected from the file extension if it is empty.
+func checkFile(name, lang string, ds *delimiterSet) (result, error) {
+	lx, err := lookupLexer(lang, name)
+	if err != nil {
+		return result{}, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return result{}, err
+	}
+	defer f.Close()
+	res, err := checkReader(f, lx, ds)
+	if err != nil {
+		return result{}, fmt.Errorf("%s: %v", name, err)
+	}
+	return res, nil
 }
 
-// isBalanced returns whether the given expression
-// has balanced brackets.
-func isBalanced(expr string) bool {
-	s := stack{}
-	for _, e := range expr {
-		switch getOperatorType(e) {
-		case openBracket:
-			s.push(e)
-		case closedBracket:
-			last := s.pop()
-			if last == nil || bracketPairs[*last] != e {
-				return false
-			}
-		}
+// printFileResult prints whether the file is balanced. The file is
+// only read again to show the source when there is an error.
+func printFileResult(name string, res result) {
+	if res.Balanced {
+		log.Printf("%s is balanced.\n", name)
+		return
 	}
-
-	return len(s.elems) == 0
+	log.Printf("%s is not balanced.\n", name)
+	src, err := os.ReadFile(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(os.Stderr, diagnostic(name, string(src), res))
 }
 
-// printResult prints whether the expression is balanced.
-func printResult(expr string, balanced bool) {
-	if balanced {
-		log.Printf("%s is balanced.\n", expr)
+// printRepair prints the smallest repair that balances the source,
+// as a diff of the changed lines. The repaired source itself is
+// printed too when it is a single expression.
+func printRepair(name, src string, lx lexer, ds *delimiterSet, res result) {
+	toks, err := scanDelimiters(strings.NewReader(src), lx, ds)
+	if err != nil {
+		log.Fatal(err)
+	}
+	edits, err := repair(src, toks, ds, res.Pos.Offset)
+	if err != nil {
+		log.Println(err)
 		return
 	}
-	log.Printf("%s is not balanced.\n", expr)
+	repaired := applyEdits(src, edits)
+	if res, err := checkReader(strings.NewReader(repaired), lx, ds); err != nil || !res.Balanced {
+		log.Println("No repair found that balances it.")
+		return
+	}
+	log.Printf("Fewest edits to balance it (%d): %s\n", len(edits), describeEdits(src, edits))
+	if name == "expr" {
+		log.Printf("Repaired: %s\n", repaired)
+	}
+	if err := writeDiff(os.Stdout, name, src, edits); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func main() {
 	expr := flag.String("expr", "", "The expression to validate brackets on.")
+	file := flag.String("file", "", "A source file to validate brackets in, instead of -expr.")
+	lang := flag.String("lang", "", "The language to check in: plain, go, json, c or js. Detected from the -file extension if empty.")
+	pairs := flag.String("pairs", bracketPairs, "The delimiter pairs to check, such as () or begin:end, separated by spaces or commas.")
+	tags := flag.String("tags", "", "Also match tags by name: html or xml.")
+	fix := flag.Bool("fix", false, "Suggest the fewest insertions and deletions that balance an unbalanced source.")
+	lintMode := flag.Bool("lint", false, "Check every file under the paths given as arguments, or the current directory.")
+	workers := flag.Int("j", runtime.NumCPU(), "The number of files checked at once with -lint.")
+	format := flag.String("format", "text", "The -lint output format: text, json or sarif.")
 	flag.Parse()
-	printResult(*expr, isBalanced(*expr))
+	ds, err := parsePairs(*pairs, *tags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *lintMode {
+		paths := flag.Args()
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+		if _, err := lookupLexer(*lang, ""); err != nil {
+			log.Fatal(err)
+		}
+		files, err := lintFiles(paths, *lang)
+		if err != nil {
+			log.Fatal(err)
+		}
+		results := lint(files, *lang, ds, *workers)
+		if err := writeLint(os.Stdout, results, *format); err != nil {
+			log.Fatal(err)
+		}
+		for _, fr := range results {
+			if fr.failed() {
+				os.Exit(1)
+			}
+		}
+		return
+	}
+	if *file == "" {
+		lx, err := lookupLexer(*lang, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		res, _ := checkReader(strings.NewReader(*expr), lx, ds)
+		printResult(*expr, res)
+		if *fix && !res.Balanced {
+			printRepair("expr", *expr, lx, ds, res)
+		}
+		return
+	}
+	res, err := checkFile(*file, *lang, ds)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printFileResult(*file, res)
+	if *fix && !res.Balanced {
+		src, err := os.ReadFile(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lx, err := lookupLexer(*lang, *file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printRepair(*file, string(src), lx, ds, res)
+	}
 }
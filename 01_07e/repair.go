@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRepairTokens is the most delimiters a repair is searched for.
+// The search takes cubic time in the number of delimiters.
+const maxRepairTokens = 600
+
+// edit is an insertion or deletion in the source.
+type edit struct {
+	// offset and end are the byte offsets of the deleted text,
+	// and are equal for an insertion.
+	offset int
+	end    int
+	text   string
+}
+
+// repairCost is how many edits a repair makes and how far in bytes
+// they are from the error in total. Fewer edits always cost less.
+type repairCost struct {
+	edits int
+	dist  int
+}
+
+// plus returns the sum of the costs.
+func (c repairCost) plus(d repairCost) repairCost {
+	return repairCost{edits: c.edits + d.edits, dist: c.dist + d.dist}
+}
+
+// less returns whether c costs less than d.
+func (c repairCost) less(d repairCost) bool {
+	if c.edits != d.edits {
+		return c.edits < d.edits
+	}
+	return c.dist < d.dist
+}
+
+// repairStep is how a repair deals with the first delimiter of a span.
+type repairStep int8
+
+const (
+	deleteDelimiter repairStep = iota
+	insertOpener
+	insertCloser
+	matchCloser
+)
+
+// repairChoice is the best step for a span, with the delimiter
+// it is closed at for insertCloser and matchCloser.
+type repairChoice struct {
+	step repairStep
+	k    int
+}
+
+// scanDelimiters returns the openers and closers of the source in
+// order, skipping whatever the lexer says is not code.
+func scanDelimiters(r io.Reader, lx lexer, ds *delimiterSet) ([]token, error) {
+	s := newScanner(r)
+	var toks []token
+	for !s.eof() {
+		if lx.skip(s) {
+			continue
+		}
+		tok, ok := ds.next(s)
+		if !ok {
+			s.next()
+			continue
+		}
+		if tok.kind != otherOperator {
+			tok.end = s.pos.Offset
+			toks = append(toks, tok)
+		}
+	}
+	return toks, s.err
+}
+
+// openerOf returns the opener of the pair that the closer closes.
+func (ds *delimiterSet) openerOf(close string) string {
+	for _, d := range ds.delims {
+		if d.opener && d.close == close {
+			return d.text
+		}
+	}
+	if ds.tags != "" && strings.HasPrefix(close, "</") {
+		return "<" + close[2:]
+	}
+	return ""
+}
+
+// repair returns the fewest insertions and deletions of delimiters
+// that balance the source. Of the repairs with the fewest edits, it
+// picks the one whose edits are closest to the error at errOffset.
+//
+// The search is over spans of the delimiters. The first delimiter of
+// a span is either deleted, given an inserted opener, matched with a
+// later closer of the span, or given an inserted closer before some
+// later delimiter. Whatever it encloses and whatever follows are then
+// repaired as spans of their own.
+func repair(src string, toks []token, ds *delimiterSet, errOffset int) ([]edit, error) {
+	n := len(toks)
+	if n > maxRepairTokens {
+		return nil, fmt.Errorf("too many delimiters to repair: %d, at most %d", n, maxRepairTokens)
+	}
+	dist := func(offset int) int {
+		if offset < errOffset {
+			return errOffset - offset
+		}
+		return offset - errOffset
+	}
+	// An inserted opener goes right after the delimiter before the
+	// closer, and an inserted closer right before the next delimiter.
+	openerAt := func(i int) int {
+		if i == 0 {
+			return 0
+		}
+		return toks[i-1].end
+	}
+	closerAt := func(k int) int {
+		if k == n {
+			return len(src)
+		}
+		return toks[k].pos.Offset
+	}
+
+	// cost[i*(n+1)+j] is the cheapest repair of toks[i:j].
+	cost := make([]repairCost, (n+1)*(n+1))
+	choice := make([]repairChoice, (n+1)*(n+1))
+	at := func(i, j int) int { return i*(n+1) + j }
+	for length := 1; length <= n; length++ {
+		for i := 0; i+length <= n; i++ {
+			j := i + length
+			t := toks[i]
+			best := repairCost{1, dist(t.pos.Offset)}.plus(cost[at(i+1, j)])
+			bestChoice := repairChoice{step: deleteDelimiter}
+			try := func(c repairCost, rc repairChoice) {
+				if c.less(best) {
+					best, bestChoice = c, rc
+				}
+			}
+			if t.kind == closedBracket {
+				try(repairCost{1, dist(openerAt(i))}.plus(cost[at(i+1, j)]),
+					repairChoice{step: insertOpener})
+			} else {
+				for k := i + 1; k <= j; k++ {
+					if k < j && toks[k].text == t.close {
+						try(cost[at(i+1, k)].plus(cost[at(k+1, j)]),
+							repairChoice{step: matchCloser, k: k})
+					}
+					try(repairCost{1, dist(closerAt(k))}.plus(cost[at(i+1, k)]).plus(cost[at(k, j)]),
+						repairChoice{step: insertCloser, k: k})
+				}
+			}
+			cost[at(i, j)], choice[at(i, j)] = best, bestChoice
+		}
+	}
+
+	// The edits are listed from left to right, so that insertions at
+	// the same offset keep their nesting.
+	var edits []edit
+	var walk func(i, j int)
+	walk = func(i, j int) {
+		if i >= j {
+			return
+		}
+		t, c := toks[i], choice[at(i, j)]
+		switch c.step {
+		case deleteDelimiter:
+			edits = append(edits, edit{offset: t.pos.Offset, end: t.end})
+			walk(i+1, j)
+		case insertOpener:
+			off := openerAt(i)
+			edits = append(edits, edit{offset: off, end: off, text: ds.openerOf(t.text)})
+			walk(i+1, j)
+		case matchCloser:
+			walk(i+1, c.k)
+			walk(c.k+1, j)
+		case insertCloser:
+			walk(i+1, c.k)
+			off := closerAt(c.k)
+			edits = append(edits, edit{offset: off, end: off, text: t.close})
+			walk(c.k, j)
+		}
+	}
+	walk(0, n)
+
+	sort.SliceStable(edits, func(a, b int) bool { return edits[a].offset < edits[b].offset })
+	return edits, nil
+}
+
+// applyEdits returns the source with the edits made. The edits must
+// be sorted by offset. An inserted delimiter that would run into a
+// word, such as end after a name, is kept apart from it by a space,
+// so that it is still read as a delimiter.
+func applyEdits(src string, edits []edit) string {
+	var b strings.Builder
+	var prev rune
+	// wordEnd is whether the last text written was an inserted
+	// delimiter ending in a word rune.
+	wordEnd := false
+	write := func(text string, inserted bool) {
+		if text == "" {
+			return
+		}
+		first, _ := utf8.DecodeRuneInString(text)
+		if isWordRune(first) && isWordRune(prev) && (inserted || wordEnd) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(text)
+		prev, _ = utf8.DecodeLastRuneInString(text)
+		wordEnd = inserted && isWordRune(prev)
+	}
+	last := 0
+	for _, e := range edits {
+		write(src[last:e.offset], false)
+		write(e.text, true)
+		last = e.end
+	}
+	write(src[last:], false)
+	return b.String()
+}
+
+// writeDiff writes the lines changed by the edits, with the original
+// lines marked - and the repaired ones marked +.
+func writeDiff(w io.Writer, name, src string, edits []edit) error {
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s (repaired)\n", name, name); err != nil {
+		return err
+	}
+	for i := 0; i < len(edits); {
+		start := strings.LastIndexByte(src[:edits[i].offset], '\n') + 1
+		stop := lineEnd(src, edits[i].end)
+		j := i + 1
+		// Edits on the same lines are shown together.
+		for j < len(edits) && edits[j].offset <= stop {
+			if end := lineEnd(src, edits[j].end); end > stop {
+				stop = end
+			}
+			j++
+		}
+		group := make([]edit, j-i)
+		for k, e := range edits[i:j] {
+			e.offset -= start
+			e.end -= start
+			group[k] = e
+		}
+		old := src[start:stop]
+		line := strings.Count(src[:start], "\n") + 1
+		if _, err := fmt.Fprintf(w, "@@ line %d @@\n%s\n%s\n", line,
+			prefixLines("-", old), prefixLines("+", applyEdits(old, group))); err != nil {
+			return err
+		}
+		i = j
+	}
+	return nil
+}
+
+// lineEnd returns the offset of the end of the line the offset is on.
+func lineEnd(src string, offset int) int {
+	if i := strings.IndexByte(src[offset:], '\n'); i >= 0 {
+		return offset + i
+	}
+	return len(src)
+}
+
+// prefixLines puts the prefix before every line of the text.
+func prefixLines(prefix, text string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
+// describeEdits returns the edits as a short list such as
+// insert ")" at 1:5, delete "]" at 2:1.
+func describeEdits(src string, edits []edit) string {
+	parts := make([]string, len(edits))
+	for i, e := range edits {
+		pos := position{Line: 1, Column: 1}
+		for _, r := range src[:e.offset] {
+			pos = advance(pos, r)
+		}
+		if e.end > e.offset {
+			parts[i] = fmt.Sprintf("delete %q at %s", src[e.offset:e.end], pos)
+		} else {
+			parts[i] = fmt.Sprintf("insert %q at %s", e.text, pos)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// scanner reads source from an io.Reader a little at a time
+// and keeps track of the position of the next byte.
+type scanner struct {
+	r   *bufio.Reader
+	pos position
+	// prev is the last rune consumed, or 0 at the start.
+	prev rune
+	err  error
+}
+
+// newScanner returns a scanner at the start of the source.
+func newScanner(r io.Reader) *scanner {
+	return &scanner{
+		r:   bufio.NewReaderSize(r, 64*1024),
+		pos: position{Line: 1, Column: 1},
+	}
+}
+
+// peek returns up to the next n bytes without consuming them.
+// Fewer bytes are returned at the end of the source.
+func (s *scanner) peek(n int) []byte {
+	b, err := s.r.Peek(n)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull && s.err == nil {
+		s.err = err
+	}
+	return b
+}
+
+// hasPrefix returns whether the source continues with p.
+func (s *scanner) hasPrefix(p string) bool {
+	return bytes.HasPrefix(s.peek(len(p)), []byte(p))
+}
+
+// eof returns whether the whole source has been consumed.
+func (s *scanner) eof() bool {
+	return len(s.peek(1)) == 0
+}
+
+// next consumes and returns the next rune, or false at the end.
+func (s *scanner) next() (rune, bool) {
+	r, size, err := s.r.ReadRune()
+	if err != nil {
+		if err != io.EOF && s.err == nil {
+			s.err = err
+		}
+		return 0, false
+	}
+	s.pos = advance(s.pos, r)
+	s.prev = r
+	if r == utf8.RuneError && size == 1 {
+		// advance counted the replacement rune's length,
+		// but only one byte of invalid UTF-8 was read.
+		s.pos.Offset -= utf8.RuneLen(r) - 1
+	}
+	return r, true
+}
+
+// skip consumes the next n bytes.
+func (s *scanner) skip(n int) {
+	end := s.pos.Offset + n
+	for s.pos.Offset < end {
+		if _, ok := s.next(); !ok {
+			return
+		}
+	}
+}
+
+// skipPast consumes the source up to and including end,
+// or to the end of the source if end never comes.
+func (s *scanner) skipPast(end string) {
+	for !s.eof() {
+		if s.hasPrefix(end) {
+			s.skip(len(end))
+			return
+		}
+		s.next()
+	}
+}